@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API keys look like "cake_<id>.<secret>". Only the SHA-256 of the secret
+// is stored, the id finds the key without scanning all of them.
+const (
+	APIKeyPrefix      = "cake_"
+	APIKeyAuthScheme  = "ApiKey "
+	MaxAPIKeyLifetime = 365
+)
+
+// Scopes limit what an API key can do, whatever the role of its owner.
+// No scope lets a key manage credentials or the account, see
+// Principal.AuthorizeSession.
+const (
+	ScopeUserRead  = "user:read"
+	ScopeUserWrite = "user:write"
+	ScopeAdmin     = "admin"
+)
+
+var (
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrInsufficientScope = errors.New("api key scope does not allow this request")
+)
+
+type APIKey struct {
+	ID      string
+	Name    string
+	Owner   string
+	Hash    string
+	Scopes  []string
+	Created time.Time
+	// Expires is zero for keys that never expire.
+	Expires  time.Time
+	LastUsed time.Time
+	Revoked  bool
+}
+
+func (k APIKey) Active(now time.Time) bool {
+	return !k.Revoked && (k.Expires.IsZero() || now.Before(k.Expires))
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows says whether the key may call a route with the given role.
+// Reading needs any user scope, everything else needs user:write.
+func (k APIKey) Allows(accessRole, method string) bool {
+	if accessRole == "AdminRole" {
+		return k.HasScope(ScopeAdmin)
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return k.HasScope(ScopeUserRead) || k.HasScope(ScopeUserWrite)
+	}
+	return k.HasScope(ScopeUserWrite)
+}
+
+type APIKeyRepository interface {
+	Add(context.Context, APIKey) error
+	Get(context.Context, string) (APIKey, error)
+	// List returns the keys of the owner, or all keys for an empty owner.
+	List(context.Context, string) ([]APIKey, error)
+	Touch(context.Context, string, time.Time) error
+	Revoke(context.Context, string) error
+}
+
+type InMemoryAPIKeyStorage struct {
+	lock sync.RWMutex
+	keys map[string]APIKey
+}
+
+func NewInMemoryAPIKeyStorage() *InMemoryAPIKeyStorage {
+	return &InMemoryAPIKeyStorage{
+		lock: sync.RWMutex{},
+		keys: make(map[string]APIKey),
+	}
+}
+
+func (s *InMemoryAPIKeyStorage) Add(ctx context.Context, key APIKey) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.keys[key.ID]; ok {
+		return errors.New("api key already exists")
+	}
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *InMemoryAPIKeyStorage) Get(ctx context.Context, id string) (APIKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return key, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *InMemoryAPIKeyStorage) List(ctx context.Context, owner string) ([]APIKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	keys := make([]APIKey, 0)
+	for _, key := range s.keys {
+		if owner == "" || key.Owner == owner {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Created.Before(keys[j].Created) })
+	return keys, nil
+}
+
+func (s *InMemoryAPIKeyStorage) Touch(ctx context.Context, id string, at time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsed = at
+	s.keys[id] = key
+	return nil
+}
+
+func (s *InMemoryAPIKeyStorage) Revoke(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.Revoked = true
+	s.keys[id] = key
+	return nil
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewAPIKey returns the key to store and the raw key to show once.
+func NewAPIKey(owner, name string, scopes []string, lifetimeDays int) (APIKey, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	key := APIKey{
+		ID:      id,
+		Name:    name,
+		Owner:   owner,
+		Hash:    hashAPIKeySecret(secret),
+		Scopes:  scopes,
+		Created: time.Now(),
+	}
+	if lifetimeDays > 0 {
+		key.Expires = key.Created.AddDate(0, 0, lifetimeDays)
+	}
+	return key, APIKeyPrefix + id + "." + secret, nil
+}
+
+// AuthenticateAPIKey finds the active key for a raw key and records its use.
+func (j *JWTService) AuthenticateAPIKey(ctx context.Context, raw string) (APIKey, error) {
+	invalid := errors.New("invalid api key")
+	idAndSecret := strings.SplitN(strings.TrimPrefix(raw, APIKeyPrefix), ".", 2)
+	if !strings.HasPrefix(raw, APIKeyPrefix) || len(idAndSecret) != 2 {
+		return APIKey{}, invalid
+	}
+	key, err := j.apiKeys.Get(ctx, idAndSecret[0])
+	if err != nil {
+		return APIKey{}, invalid
+	}
+	hash := hashAPIKeySecret(idAndSecret[1])
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(key.Hash)) != 1 || !key.Active(now) {
+		return APIKey{}, invalid
+	}
+	if err := j.apiKeys.Touch(ctx, key.ID, now); err != nil {
+		return APIKey{}, err
+	}
+	key.LastUsed = now
+	return key, nil
+}
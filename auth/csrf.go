@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Browser clients can keep the session in an HttpOnly cookie instead of
+// sending a bearer token. Cookies are sent by the browser on their own,
+// so state-changing requests with a cookie session also need the CSRF
+// token in the X-CSRF-Token header. The token is readable by scripts of
+// our origin from the csrf cookie, other sites can't read it.
+const (
+	SessionCookieName = "cake_session"
+	CSRFCookieName    = "cake_csrf"
+	CSRFHeaderName    = "X-CSRF-Token"
+	// SessionTTL is the lifetime of tokens made by jwtauth.ForgeToken.
+	SessionTTL = time.Hour
+)
+
+func newCSRFKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CSRFToken is bound to the session, so a token of one session is
+// useless for another and nothing has to be stored.
+func (j *JWTService) CSRFToken(sessionID string) string {
+	mac := hmac.New(sha256.New, j.csrfKey)
+	mac.Write([]byte(sessionID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidCSRF lets safe methods through, others need the token of the
+// session in the CSRF header.
+func (j *JWTService) ValidCSRF(r *http.Request, sessionID string) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	token := r.Header.Get(CSRFHeaderName)
+	return token != "" && hmac.Equal([]byte(token), []byte(j.CSRFToken(sessionID)))
+}
@@ -0,0 +1,81 @@
+// Package auth issues and checks the credentials of the API: JWT
+// sessions, cookie sessions with CSRF tokens, API keys and TOTP second
+// factors.
+package auth
+
+import (
+	"context"
+
+	jwtauth "github.com/openware/rango/pkg/auth"
+
+	"golang-api/domain"
+)
+
+type JWTService struct {
+	keys     *jwtauth.KeyStore
+	apiKeys  APIKeyRepository
+	sessions SessionRepository
+	// csrfKey signs the CSRF tokens of cookie sessions.
+	csrfKey   []byte
+	mfaLogins *mfaLogins
+}
+
+func NewJWTService(privKeyPath, pubKeyPath string) (*JWTService, error) {
+	keys, err := jwtauth.LoadOrGenerateKeys(privKeyPath, pubKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	csrfKey, err := newCSRFKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTService{
+		keys:      keys,
+		apiKeys:   NewInMemoryAPIKeyStorage(),
+		sessions:  NewInMemorySessionStorage(),
+		csrfKey:   csrfKey,
+		mfaLogins: newMFALogins(),
+	}, nil
+}
+
+func (j *JWTService) GenearateJWT(u domain.User) (string, error) {
+	token, _, err := j.IssueSession(nil, u, LevelPassword)
+	return token, err
+}
+
+func (j *JWTService) ParseJWT(jwt string) (jwtauth.Auth, error) {
+	return jwtauth.ParseAndValidate(jwt, j.keys.PublicKey)
+}
+
+// Sessions is the store of issued sessions.
+func (j *JWTService) Sessions() SessionRepository {
+	return j.sessions
+}
+
+// APIKeys is the store of API keys.
+func (j *JWTService) APIKeys() APIKeyRepository {
+	return j.apiKeys
+}
+
+// RevokeUser ends every session and revokes every API key of a user, for
+// example when the account is deleted and its email may be taken again.
+func (j *JWTService) RevokeUser(ctx context.Context, email string) error {
+	if _, err := j.sessions.DeleteAll(ctx, email); err != nil {
+		return err
+	}
+	keys, err := j.apiKeys.List(ctx, email)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.Revoked {
+			continue
+		}
+		if err := j.apiKeys.Revoke(ctx, key.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	jwtauth "github.com/openware/rango/pkg/auth"
+
+	"golang-api/domain"
+)
+
+const (
+	// SubjectSession is the subject of tokens that give access to the API.
+	SubjectSession = "session"
+	// SubjectMFAPending is the subject of tokens issued after the password
+	// step of the login, they are only good for the second step.
+	SubjectMFAPending = "mfa_pending"
+	MFAPendingTTL     = 5 * time.Minute
+
+	// The level claim of a session says how the user logged in.
+	LevelPassword = 0
+	LevelMFA      = 1
+
+	RecoveryCodeCount = 10
+
+	// MaxMFAAttempts wrong codes lock a user out of the second login step
+	// for MFALockout, so that a password is not enough to guess a code.
+	MaxMFAAttempts = 5
+	MFALockout     = 15 * time.Minute
+)
+
+var (
+	// ErrInvalidMFAToken is returned for pending tokens that are forged,
+	// expired or already used.
+	ErrInvalidMFAToken = errors.New("two-factor login expired, log in again")
+	ErrMFALocked       = errors.New("too many wrong two-factor codes, try again later")
+)
+
+// mfaLogins tracks the pending tokens that were issued and not used yet,
+// and the wrong codes of every user.
+type mfaLogins struct {
+	lock     sync.Mutex
+	pending  map[string]time.Time
+	failures map[string]mfaFailures
+}
+
+type mfaFailures struct {
+	count int
+	last  time.Time
+}
+
+func newMFALogins() *mfaLogins {
+	return &mfaLogins{
+		pending:  make(map[string]time.Time),
+		failures: make(map[string]mfaFailures),
+	}
+}
+
+func (m *mfaLogins) add(id string, expires time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	for pendingID, e := range m.pending {
+		if now.After(e) {
+			delete(m.pending, pendingID)
+		}
+	}
+	m.pending[id] = expires
+}
+
+// attempt counts an attempt before the code is checked, so that parallel
+// attempts can't go past the limit.
+func (m *mfaLogins) attempt(id, email string, now time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if expires, ok := m.pending[id]; !ok || now.After(expires) {
+		return ErrInvalidMFAToken
+	}
+	f := m.failures[email]
+	if f.count >= MaxMFAAttempts && now.Sub(f.last) < MFALockout {
+		return ErrMFALocked
+	}
+	if f.count >= MaxMFAAttempts {
+		f.count = 0
+	}
+	m.failures[email] = mfaFailures{count: f.count + 1, last: now}
+	return nil
+}
+
+func (m *mfaLogins) succeeded(id, email string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.pending, id)
+	delete(m.failures, email)
+}
+
+// GenerateMFAJWT issues a session for a user who passed both login steps.
+func (j *JWTService) GenerateMFAJWT(u domain.User) (string, error) {
+	token, _, err := j.IssueSession(nil, u, LevelMFA)
+	return token, err
+}
+
+// GenerateMFAPendingJWT issues the token of the first login step, it is
+// only good for one successful second step.
+func (j *JWTService) GenerateMFAPendingJWT(u domain.User) (string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(MFAPendingTTL)
+	j.mfaLogins.add(id, expires)
+	return jwtauth.ForgeToken("empty", u.Email, "empty", LevelPassword, j.keys.PrivateKey, map[string]interface{}{
+		"sub": SubjectMFAPending,
+		"jti": id,
+		"exp": expires.Unix(),
+	})
+}
+
+// CompleteMFALogin checks the token of the first login step and lets
+// verify check the code of the user it was issued to. The token is used up
+// by the first success, wrong codes count against the user whatever token
+// they come with.
+func (j *JWTService) CompleteMFALogin(token string, verify func(email string) (domain.User, error)) (domain.User, error) {
+	pending, err := j.ParseJWT(token)
+	if err != nil || pending.Subject != SubjectMFAPending || pending.Id == "" {
+		return domain.User{}, ErrInvalidMFAToken
+	}
+	if err := j.mfaLogins.attempt(pending.Id, pending.Email, time.Now()); err != nil {
+		return domain.User{}, err
+	}
+	u, err := verify(pending.Email)
+	if err != nil {
+		return u, err
+	}
+	j.mfaLogins.succeeded(pending.Id, pending.Email)
+	return u, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRecoveryCodes returns the codes to show the user once and the
+// hashes to store.
+func NewRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	hashes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// CheckSecondFactor accepts a TOTP code or an unused recovery code. The
+// returned user remembers the used code and has to be saved.
+func CheckSecondFactor(u domain.User, code string) (domain.User, bool) {
+	if step, ok := VerifyTOTP(u.MFA.Secret, code, time.Now(), u.MFA.LastStep); ok {
+		u.MFA.LastStep = step
+		return u, true
+	}
+	hash := hashRecoveryCode(code)
+	for i, stored := range u.MFA.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			// a new slice, the stored user may share the old one
+			left := make([]string, 0, len(u.MFA.RecoveryCodes)-1)
+			left = append(left, u.MFA.RecoveryCodes[:i]...)
+			u.MFA.RecoveryCodes = append(left, u.MFA.RecoveryCodes[i+1:]...)
+			return u, true
+		}
+	}
+	return u, false
+}
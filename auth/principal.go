@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang-api/domain"
+	"golang-api/storage"
+)
+
+var (
+	// ErrUnauthorized is returned for requests without valid credentials.
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrMFARequired      = errors.New("two-factor authentication required")
+	ErrSessionRequired  = errors.New("api keys can't manage credentials or the account, log in instead")
+)
+
+// Principal is who made an authenticated request and how.
+type Principal struct {
+	User  domain.User
+	Level int
+	// APIKey is nil for JWT sessions.
+	APIKey *APIKey
+	// Session is the ID of the JWT session, empty for API keys.
+	Session string
+	// Cookie is set when the token came in the session cookie.
+	Cookie bool
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a context carrying the principal, the HTTP
+// middleware does it for every authenticated request.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFrom returns the principal put into the context with WithPrincipal.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+// Authorize checks that the principal may call an operation of the role.
+// method is the HTTP method of the call, or GET for reads in transports
+// without methods. API keys are checked by scope, sessions need 2FA for
+// admin operations.
+func (p Principal) Authorize(role, method string) error {
+	if role == "AdminRole" && p.User.Role != "AdminRole" {
+		return ErrPermissionDenied
+	}
+	if p.APIKey != nil && !p.APIKey.Allows(role, method) {
+		return ErrInsufficientScope
+	}
+	if p.APIKey == nil && role == "AdminRole" && p.Level < LevelMFA {
+		return ErrMFARequired
+	}
+	return nil
+}
+
+// AuthorizeSession checks that the principal logged in. Operations that
+// manage credentials or the account need it, so a leaked API key can't
+// be turned into a takeover of the account.
+func (p Principal) AuthorizeSession() error {
+	if p.APIKey != nil {
+		return ErrSessionRequired
+	}
+	return nil
+}
+
+// Authenticate finds the principal of a request from a bearer JWT, the
+// session cookie or an API key.
+func (j *JWTService) Authenticate(r *http.Request, users storage.UserRepository) (Principal, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		if c, err := r.Cookie(SessionCookieName); err == nil {
+			p, err := j.authenticateSession(r.Context(), c.Value, users)
+			p.Cookie = true
+			return p, err
+		}
+	}
+	return j.AuthenticateHeader(r.Context(), authHeader, users)
+}
+
+// AuthenticateHeader finds the principal from the value of an
+// Authorization header, a bearer JWT or an API key. Transports other than
+// HTTP pass their metadata to it.
+func (j *JWTService) AuthenticateHeader(ctx context.Context, authHeader string, users storage.UserRepository) (Principal, error) {
+	if strings.HasPrefix(authHeader, APIKeyAuthScheme) {
+		key, err := j.AuthenticateAPIKey(ctx, strings.TrimPrefix(authHeader, APIKeyAuthScheme))
+		if err != nil {
+			return Principal{}, ErrUnauthorized
+		}
+		user, err := users.Get(ctx, key.Owner)
+		if err != nil {
+			return Principal{}, ErrUnauthorized
+		}
+		return Principal{User: user, Level: LevelPassword, APIKey: &key}, nil
+	}
+	return j.authenticateSession(ctx, strings.TrimPrefix(authHeader, "Bearer "), users)
+}
+
+func (j *JWTService) authenticateSession(ctx context.Context, token string, users storage.UserRepository) (Principal, error) {
+	jwtAuth, err := j.ParseJWT(token)
+	if err != nil || jwtAuth.Subject != SubjectSession {
+		return Principal{}, ErrUnauthorized
+	}
+	session, err := j.sessions.Get(ctx, jwtAuth.Id)
+	if err != nil || session.Email != jwtAuth.Email {
+		return Principal{}, ErrUnauthorized
+	}
+	user, err := users.Get(ctx, jwtAuth.Email)
+	if err != nil {
+		return Principal{}, ErrUnauthorized
+	}
+	// sessions from before the user enabled 2FA are no longer valid
+	if user.MFA.Enabled && session.Level < LevelMFA {
+		return Principal{}, ErrUnauthorized
+	}
+	if err := j.sessions.Touch(ctx, session.ID, time.Now()); err != nil {
+		return Principal{}, ErrUnauthorized
+	}
+	return Principal{User: user, Level: session.Level, Session: session.ID}, nil
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	jwtauth "github.com/openware/rango/pkg/auth"
+
+	"golang-api/domain"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is one issued token, its ID is the jti claim. A token is only
+// accepted while its session exists, so deleting a session logs it out.
+type Session struct {
+	ID        string
+	Email     string
+	Level     int
+	Created   time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+}
+
+// Expired tells if the token of the session ran out at now, see SessionTTL.
+func (s Session) Expired(now time.Time) bool {
+	return !now.Before(s.Created.Add(SessionTTL))
+}
+
+// SessionRepository stores sessions. Expired sessions are gone: Get and
+// Touch don't find them and List leaves them out.
+type SessionRepository interface {
+	Add(context.Context, Session) error
+	Get(context.Context, string) (Session, error)
+	// List returns the sessions of a user, the oldest first.
+	List(context.Context, string) ([]Session, error)
+	Touch(context.Context, string, time.Time) error
+	Delete(context.Context, string) error
+	// DeleteAll logs the user out everywhere and returns how many
+	// sessions were deleted.
+	DeleteAll(context.Context, string) (int, error)
+}
+
+// InMemorySessionStorage drops expired sessions when they are read, and
+// all of them once per SessionTTL when sessions are added.
+type InMemorySessionStorage struct {
+	lock     sync.RWMutex
+	sessions map[string]Session
+	now      func() time.Time
+	pruned   time.Time
+}
+
+func NewInMemorySessionStorage() *InMemorySessionStorage {
+	return &InMemorySessionStorage{
+		lock:     sync.RWMutex{},
+		sessions: make(map[string]Session),
+		now:      time.Now,
+	}
+}
+
+func (s *InMemorySessionStorage) Add(ctx context.Context, session Session) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if now := s.now(); now.Sub(s.pruned) >= SessionTTL {
+		for id, old := range s.sessions {
+			if old.Expired(now) {
+				delete(s.sessions, id)
+			}
+		}
+		s.pruned = now
+	}
+	if _, ok := s.sessions[session.ID]; ok {
+		return errors.New("session already exists")
+	}
+	s.sessions[session.ID] = session
+	return nil
+}
+
+// get returns a session that did not expire, expired ones are deleted.
+// The caller holds the write lock.
+func (s *InMemorySessionStorage) get(id string) (Session, error) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return session, ErrSessionNotFound
+	}
+	if session.Expired(s.now()) {
+		delete(s.sessions, id)
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *InMemorySessionStorage) Get(ctx context.Context, id string) (Session, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.get(id)
+}
+
+func (s *InMemorySessionStorage) List(ctx context.Context, email string) ([]Session, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.now()
+	sessions := make([]Session, 0)
+	for id, session := range s.sessions {
+		if session.Email != email {
+			continue
+		}
+		if session.Expired(now) {
+			delete(s.sessions, id)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created.Before(sessions[j].Created) })
+	return sessions, nil
+}
+
+func (s *InMemorySessionStorage) Touch(ctx context.Context, id string, at time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	session.LastSeen = at
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *InMemorySessionStorage) Delete(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *InMemorySessionStorage) DeleteAll(ctx context.Context, email string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	deleted := 0
+	for id, session := range s.sessions {
+		if session.Email == email {
+			delete(s.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// IssueSession records a session and forges its token. r is the login
+// request, nil for tokens made without one.
+func (j *JWTService) IssueSession(r *http.Request, u domain.User, level int) (string, Session, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return "", Session{}, err
+	}
+	now := time.Now()
+	session := Session{ID: id, Email: u.Email, Level: level, Created: now, LastSeen: now}
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+		session.IP = clientIP(r)
+		session.UserAgent = r.UserAgent()
+	}
+	if err := j.sessions.Add(ctx, session); err != nil {
+		return "", Session{}, err
+	}
+	token, err := jwtauth.ForgeToken("empty", u.Email, "empty", level, j.keys.PrivateKey, map[string]interface{}{
+		"jti": id,
+	})
+	return token, session, err
+}
+
+// clientIP is the address of the peer, headers like X-Forwarded-For are
+// not trusted since anyone can send them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
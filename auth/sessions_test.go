@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 10, 30, 12, 0, 0, 0, time.UTC)
+	s := NewInMemorySessionStorage()
+	s.now = func() time.Time { return now }
+
+	s.Add(ctx, Session{ID: "old", Email: "test@mail.com", Created: now})
+	s.Add(ctx, Session{ID: "other", Email: "other@mail.com", Created: now})
+	now = now.Add(SessionTTL / 2)
+	s.Add(ctx, Session{ID: "new", Email: "test@mail.com", Created: now})
+
+	if sessions, _ := s.List(ctx, "test@mail.com"); len(sessions) != 2 {
+		t.Fatal("unexpected sessions", sessions)
+	}
+
+	now = now.Add(SessionTTL / 2)
+	sessions, _ := s.List(ctx, "test@mail.com")
+	if len(sessions) != 1 || sessions[0].ID != "new" {
+		t.Error("expired session is listed", sessions)
+	}
+	if _, err := s.Get(ctx, "old"); err != ErrSessionNotFound {
+		t.Error("expired session was found", err)
+	}
+	if err := s.Touch(ctx, "other", now); err != ErrSessionNotFound {
+		t.Error("expired session was touched", err)
+	}
+
+	// the next login after a TTL drops every expired session
+	s.Add(ctx, Session{ID: "stale", Email: "stale@mail.com", Created: now})
+	now = now.Add(SessionTTL)
+	s.Add(ctx, Session{ID: "latest", Email: "test@mail.com", Created: now})
+	if len(s.sessions) != 1 {
+		t.Error("expired sessions are kept", s.sessions)
+	}
+}
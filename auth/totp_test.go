@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	// the RFC lists 8 digit codes, these are their last 6 digits
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		step, ok := VerifyTOTP(secret, expected, time.Unix(unix, 0), 0)
+		if !ok || step != unix/totpPeriod {
+			t.Errorf("%d: code %s was not accepted", unix, expected)
+		}
+		if _, ok := VerifyTOTP(secret, expected, time.Unix(unix, 0), unix/totpPeriod); ok {
+			t.Errorf("%d: code %s was accepted twice", unix, expected)
+		}
+	}
+	code, err := TOTPCode(secret, time.Unix(59, 0))
+	if err != nil || code != "287082" {
+		t.Error("unexpected code", code, err)
+	}
+}
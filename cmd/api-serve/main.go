@@ -0,0 +1,212 @@
+// Command api-serve runs the cake API with in-memory storage, HTTP on
+// :8080 and gRPC on CAKE_GRPC_ADDR (:9090 by default). The webhook queue
+// is kept in CAKE_WEBHOOKS_FILE (webhooks.json by default). Deleted
+// accounts are purged after CAKE_DELETION_GRACE (720h by default), users
+// deleted by admins after CAKE_TOMBSTONE_RETENTION_DAYS (30 by default).
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/grpcapi"
+	"golang-api/httpapi"
+	"golang-api/service"
+	"golang-api/storage"
+	"golang-api/webhooks"
+)
+
+func main() {
+	os.Setenv("CAKE_ADMIN_EMAIL", "admin@mail.com")
+	os.Setenv("CAKE_ADMIN_PASSWORD", "adminadmin")
+
+	timeout, err := storage.TimeoutFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	domain.DefaultEmailNormalizer, err = domain.EmailNormalizerFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	policy, err := domain.PasswordPolicyFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	users := storage.WithTimeout(storage.FromLegacy(storage.NewInMemoryUserStorage()), timeout)
+	usersService := service.NewUsers(users, service.LogMailer{}, policy)
+	grace, err := service.DeletionGraceFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	usersService.SetDeletionGrace(grace)
+	retention, err := service.TombstoneRetentionFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	userService := httpapi.NewUserService(usersService)
+
+	jwtService, err := auth.NewJWTService("pubkey.rsa", "privkey.rsa")
+	if err != nil {
+		panic(err)
+	}
+
+	sunset, err := httpapi.LegacySunsetFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	headers, err := httpapi.HeaderPoliciesFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	webhooksFile := os.Getenv("CAKE_WEBHOOKS_FILE")
+	if webhooksFile == "" {
+		webhooksFile = "webhooks.json"
+	}
+	webhookStore, err := webhooks.NewFileStore(webhooksFile)
+	if err != nil {
+		panic(err)
+	}
+	webhookRetention, err := webhooks.RetentionFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	dispatcher := webhooks.NewDispatcher(webhookStore, nil, webhooks.DefaultRetryPolicy())
+	dispatcher.SetRetention(webhookRetention)
+	usersService.AddRecordKeeper(dispatcher)
+
+	// Event streams never finish on their own, they are ended as soon as
+	// the shutdown starts so the other requests can drain.
+	streamsCtx, endStreams := context.WithCancel(context.Background())
+	r := httpapi.NewRouter(userService, jwtService, httpapi.RouterConfig{
+		LegacySunset:     sunset,
+		ValidateRequests: os.Getenv("CAKE_VALIDATE_REQUESTS") == "true",
+		Headers:          headers,
+		Webhooks:         dispatcher,
+		Shutdown:         streamsCtx,
+	})
+
+	userService.AddAdmin(context.Background())
+	migration, err := storage.MigrateEmails(context.Background(), users, domain.DefaultEmailNormalizer)
+	if err != nil {
+		panic(err)
+	}
+	for email, keys := range migration.Collisions {
+		log.Printf("Users %v collide as %s, merge them by hand", keys, email)
+	}
+	for _, key := range migration.Invalid {
+		log.Printf("User %s has an invalid email", key)
+	}
+
+	// Requests get contexts derived from baseCtx, so the handlers that are
+	// still running when the shutdown times out get their storage calls cancelled.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	srv := http.Server{
+		Addr:        ":8080",
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	srv.RegisterOnShutdown(endStreams)
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	runJob := func(job func()) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job()
+		}()
+	}
+	runJob(func() { dispatcher.Run(jobsCtx, usersService.Events(), 10*time.Second) })
+	runJob(func() { purgeDeletedUsers(jobsCtx, usersService, jwtService, time.Hour) })
+	runJob(func() { purgeTombstones(jobsCtx, usersService, jwtService, retention, time.Hour) })
+
+	grpcAddr := os.Getenv("CAKE_GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	grpcListener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		panic(err)
+	}
+	grpcSrv := grpcapi.NewServer(usersService, jwtService)
+	go func() {
+		if err := grpcSrv.Serve(grpcListener); err != nil {
+			log.Println("gRPC server exited with error:", err)
+		}
+	}()
+
+	// Shutdown makes ListenAndServe return right away, main waits for
+	// stopped until the requests are drained and the jobs are done.
+	stopped := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		defer close(stopped)
+		<-interrupt
+		stopJobs()
+		grpcSrv.GracefulStop()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println("Requests were not drained in time:", err)
+			cancelRequests()
+		}
+		jobs.Wait()
+	}()
+
+	log.Printf("Server stared, press cntrl + C to stop ")
+	errr := srv.ListenAndServe()
+	if errr != http.ErrServerClosed {
+		log.Println("Server exited with error:", errr)
+		return
+	}
+	<-stopped
+	log.Println("Good bye :)")
+}
+
+// purgeDeletedUsers deletes the accounts whose grace period is over every
+// interval and revokes the credentials they had.
+func purgeDeletedUsers(ctx context.Context, users *service.Users, j *auth.JWTService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := users.PurgeDeletedAndRevoke(ctx, now, j); err != nil {
+				log.Println("Could not purge deleted users:", err)
+			}
+		}
+	}
+}
+
+// purgeTombstones purges the users admins deleted more than retention ago
+// every interval and revokes their API keys. Their sessions ended with the
+// deletion.
+func purgeTombstones(ctx context.Context, users *service.Users, j *auth.JWTService, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := users.PurgeTombstonesAndRevoke(ctx, now.Add(-retention), j)
+			if err != nil {
+				log.Println("Could not purge deleted users:", err)
+			}
+			if len(purged) > 0 {
+				log.Printf("Purged %d deleted users", len(purged))
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"errors"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrEmailDisplayName = errors.New("The email field should not contain a display name!")
+
+// EmailNormalizer brings emails to the canonical form used as the user key.
+// The domain is always lowercased and converted to punycode, folding of the
+// local part depends on the provider and is configurable.
+type EmailNormalizer struct {
+	// FoldLocalCase treats Test@mail.com and test@mail.com as one address.
+	FoldLocalCase bool
+	// StripPlusTag treats test+news@mail.com and test@mail.com as one address.
+	StripPlusTag bool
+}
+
+// DefaultEmailNormalizer is used by NormalizeEmail, binaries replace it
+// with EmailNormalizerFromEnv on start.
+var DefaultEmailNormalizer = EmailNormalizer{FoldLocalCase: true}
+
+// EmailNormalizerFromEnv reads CAKE_EMAIL_FOLD_CASE and CAKE_EMAIL_STRIP_TAG.
+func EmailNormalizerFromEnv() (EmailNormalizer, error) {
+	n := EmailNormalizer{FoldLocalCase: true}
+	var err error
+	if v := os.Getenv("CAKE_EMAIL_FOLD_CASE"); v != "" {
+		if n.FoldLocalCase, err = strconv.ParseBool(v); err != nil {
+			return n, err
+		}
+	}
+	if v := os.Getenv("CAKE_EMAIL_STRIP_TAG"); v != "" {
+		if n.StripPlusTag, err = strconv.ParseBool(v); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (n EmailNormalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	addr, err := mail.ParseAddress(raw)
+	if err != nil {
+		return "", err
+	}
+	// ParseAddress accepts "Name <a@b.c>" and "<a@b.c>", we want the bare address.
+	if addr.Name != "" || addr.Address != raw {
+		return "", ErrEmailDisplayName
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	local, domain := addr.Address[:at], addr.Address[at+1:]
+	domain, err = idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", errors.New("The email domain is invalid!")
+	}
+	if n.StripPlusTag {
+		if plus := strings.Index(local, "+"); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	if n.FoldLocalCase {
+		local = strings.ToLower(local)
+	}
+	return local + "@" + strings.ToLower(domain), nil
+}
+
+func NormalizeEmail(raw string) (string, error) {
+	return DefaultEmailNormalizer.Normalize(raw)
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestEmail_normalize(t *testing.T) {
+	t.Run("canonical form", func(t *testing.T) {
+		n := EmailNormalizer{FoldLocalCase: true}
+		emails := map[string]string{
+			"test@mail.com":           "test@mail.com",
+			" Test@Mail.COM ":         "test@mail.com",
+			"test+cake@mail.com":      "test+cake@mail.com",
+			"test@Bäckerei.de":        "test@xn--bckerei-5wa.de",
+			"test@xn--bckerei-5wa.de": "test@xn--bckerei-5wa.de",
+		}
+		for raw, expected := range emails {
+			actual, err := n.Normalize(raw)
+			if err != nil || actual != expected {
+				t.Errorf("%q: expected %q, actual %q (%v)", raw, expected, actual, err)
+			}
+		}
+	})
+	t.Run("configurable local part", func(t *testing.T) {
+		n := EmailNormalizer{StripPlusTag: true}
+		actual, _ := n.Normalize("Test+cake@Mail.com")
+		if actual != "Test@mail.com" {
+			t.Error("unexpected email", actual)
+		}
+	})
+	t.Run("invalid emails", func(t *testing.T) {
+		n := EmailNormalizer{FoldLocalCase: true}
+		for _, raw := range []string{"", "notAnEmail", "Name <a@b.c>", "<a@b.c>", "test@-mail.com"} {
+			if email, err := n.Normalize(raw); err == nil {
+				t.Errorf("%q was accepted as %q", raw, email)
+			}
+		}
+	})
+}
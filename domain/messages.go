@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"strings"
+)
+
+const DefaultLanguage = "en"
+
+// messages is the catalogue of validation messages. Keys are rule codes,
+// "field.code" keys override the message for one field. {field} and
+// {param} are replaced with the field name and the rule parameter.
+var messages = map[string]map[string]string{
+	"en": {
+		"required":           "The {field} field is required!",
+		"email":              "The {field} field should be a valid email address!",
+		"email_display_name": "The {field} field should not contain a display name!",
+		"min":                "The {field} field should be at least {param} symbols",
+		"max":                "The {field} field should be at most {param} symbols",
+		"charset":            "The {field} field should contain only {param} characters",
+		"regex":              "The {field} field has invalid format",
+		"oneof":              "The {field} field should be one of: {param}",
+		"range":              "The {field} field should be in the range {param}",
+		"url":                "The {field} field should be an http or https URL",
+		"public_url":         "The {field} field should be a public address",
+		"type":               "{field} should be a {param}",
+		"unknown_field":      "{field} is not allowed",
+
+		"password.min":           "Password at least {param} symbols",
+		"password.max":           "Password at most {param} symbols",
+		"password_lower":         "Password should contain a lowercase letter",
+		"password_upper":         "Password should contain an uppercase letter",
+		"password_digit":         "Password should contain a digit",
+		"password_symbol":        "Password should contain a special symbol",
+		"password_repeated":      "Password should not repeat a symbol more than {param} times in a row",
+		"password_sequential":    "Password should not contain more than {param} sequential symbols",
+		"password_personal":      "Password should not contain your email or favorite cake",
+		"password_breached":      "Password was found in a data breach, choose another one",
+		"favorite_cake.required": "Favorite cake should not be empty",
+		"favorite_cake.charset":  "Favorite cake should be only alphabetic",
+	},
+	"uk": {
+		"required":           "Поле {field} обов'язкове!",
+		"email":              "Поле {field} має бути коректною email адресою!",
+		"email_display_name": "Поле {field} не повинно містити ім'я!",
+		"min":                "Поле {field} має містити щонайменше {param} символів",
+		"max":                "Поле {field} має містити не більше {param} символів",
+		"charset":            "Поле {field} може містити лише символи {param}",
+		"regex":              "Поле {field} має неправильний формат",
+		"oneof":              "Поле {field} має бути одним із: {param}",
+		"range":              "Поле {field} має бути в межах {param}",
+		"url":                "Поле {field} має бути http або https адресою",
+		"public_url":         "Поле {field} має бути публічною адресою",
+		"type":               "Поле {field} має бути типу {param}",
+		"unknown_field":      "Поле {field} не дозволене",
+
+		"password.min":           "Пароль має містити щонайменше {param} символів",
+		"password.max":           "Пароль має містити не більше {param} символів",
+		"password_lower":         "Пароль має містити малу літеру",
+		"password_upper":         "Пароль має містити велику літеру",
+		"password_digit":         "Пароль має містити цифру",
+		"password_symbol":        "Пароль має містити спеціальний символ",
+		"password_repeated":      "Пароль не може повторювати символ більше {param} разів поспіль",
+		"password_sequential":    "Пароль не може містити більше {param} послідовних символів",
+		"password_personal":      "Пароль не може містити ваш email чи улюблений торт",
+		"password_breached":      "Пароль знайдено у витоку даних, оберіть інший",
+		"favorite_cake.required": "Улюблений торт не може бути порожнім",
+		"favorite_cake.charset":  "Улюблений торт може містити лише літери",
+	},
+}
+
+// Message returns the message of a rule code in a language of the
+// catalogue, unknown languages get the default one.
+func Message(lang, field, code, param string) string {
+	catalogue, ok := messages[lang]
+	if !ok {
+		catalogue = messages[DefaultLanguage]
+	}
+	template, ok := catalogue[field+"."+code]
+	if !ok {
+		template, ok = catalogue[code]
+	}
+	if !ok {
+		template = messages[DefaultLanguage][code]
+	}
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(template)
+}
+
+// HasLanguage tells whether the catalogue has messages in lang.
+func HasLanguage(lang string) bool {
+	_, ok := messages[lang]
+	return ok
+}
+
+// Localize translates the messages of field errors to lang.
+func (errs FieldErrors) Localize(lang string) FieldErrors {
+	result := make(FieldErrors, 0, len(errs))
+	for _, e := range errs {
+		e.Message = Message(lang, e.Field, e.Code, e.Param)
+		result = append(result, e)
+	}
+	return result
+}
@@ -0,0 +1,257 @@
+package domain
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy decides which passwords users may choose. Limits set to 0
+// are not checked.
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	MaxLength     int  `json:"max_length"`
+	RequireLower  bool `json:"require_lower"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+	// MaxRepeated is the longest allowed run of one symbol, like "aaa".
+	MaxRepeated int `json:"max_repeated"`
+	// MaxSequential is the longest allowed run like "abcd" or "4321".
+	MaxSequential int `json:"max_sequential"`
+	// RejectPersonal forbids passwords containing the email or the cake.
+	RejectPersonal bool `json:"reject_personal"`
+	// Breached is the corpus of leaked passwords, nil disables the check.
+	Breached BreachedPasswords `json:"-"`
+}
+
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:      8,
+		MaxLength:      64,
+		MaxRepeated:    4,
+		MaxSequential:  5,
+		RejectPersonal: true,
+	}
+}
+
+// PasswordPolicyFromEnv changes the default policy with CAKE_PASSWORD_MIN,
+// CAKE_PASSWORD_MAX, CAKE_PASSWORD_CLASSES (e.g. "lower,upper,digit,symbol")
+// and CAKE_BREACHED_INDEX, the directory built by BuildBreachIndex.
+func PasswordPolicyFromEnv() (*PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy()
+	var err error
+	if v := os.Getenv("CAKE_PASSWORD_MIN"); v != "" {
+		if policy.MinLength, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := os.Getenv("CAKE_PASSWORD_MAX"); v != "" {
+		if policy.MaxLength, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	for _, class := range strings.Split(os.Getenv("CAKE_PASSWORD_CLASSES"), ",") {
+		switch strings.TrimSpace(class) {
+		case "lower":
+			policy.RequireLower = true
+		case "upper":
+			policy.RequireUpper = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		}
+	}
+	if dir := os.Getenv("CAKE_BREACHED_INDEX"); dir != "" {
+		policy.Breached = FileBreachIndex{Dir: dir}
+	}
+	return policy, nil
+}
+
+// Check returns every rule the password breaks. email and cake are the
+// personal data of the user the password is for.
+func (p *PasswordPolicy) Check(password, email, cake string) (FieldErrors, error) {
+	var errs FieldErrors
+	fail := func(code string, param int) {
+		value := ""
+		if param > 0 {
+			value = strconv.Itoa(param)
+		}
+		errs = append(errs, NewFieldError("password", code, value))
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		fail("min", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		fail("max", p.MaxLength)
+	}
+	classes := []struct {
+		required bool
+		has      func(rune) bool
+		code     string
+	}{
+		{p.RequireLower, unicode.IsLower, "password_lower"},
+		{p.RequireUpper, unicode.IsUpper, "password_upper"},
+		{p.RequireDigit, unicode.IsDigit, "password_digit"},
+		{p.RequireSymbol, func(c rune) bool { return !unicode.IsLetter(c) && !unicode.IsDigit(c) }, "password_symbol"},
+	}
+	for _, class := range classes {
+		if class.required && strings.IndexFunc(password, class.has) < 0 {
+			fail(class.code, 0)
+		}
+	}
+	repeated, sequential := longestRuns(password)
+	if p.MaxRepeated > 0 && repeated > p.MaxRepeated {
+		fail("password_repeated", p.MaxRepeated)
+	}
+	if p.MaxSequential > 0 && sequential > p.MaxSequential {
+		fail("password_sequential", p.MaxSequential)
+	}
+	if p.RejectPersonal && containsPersonal(password, email, cake) {
+		fail("password_personal", 0)
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			fail("password_breached", 0)
+		}
+	}
+	return errs, nil
+}
+
+// longestRuns returns the longest run of one repeated symbol and the
+// longest run of symbols going up or down one by one.
+func longestRuns(password string) (int, int) {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0, 0
+	}
+	repeated, sequential := 1, 1
+	repeatRun, seqRun, step := 1, 1, rune(0)
+	for i := 1; i < len(runes); i++ {
+		diff := runes[i] - runes[i-1]
+		if diff == 0 {
+			repeatRun++
+		} else {
+			repeatRun = 1
+		}
+		switch {
+		case (diff == 1 || diff == -1) && diff == step:
+			seqRun++
+		case diff == 1 || diff == -1:
+			seqRun, step = 2, diff
+		default:
+			seqRun, step = 1, 0
+		}
+		if repeatRun > repeated {
+			repeated = repeatRun
+		}
+		if seqRun > sequential {
+			sequential = seqRun
+		}
+	}
+	return repeated, sequential
+}
+
+func containsPersonal(password, email, cake string) bool {
+	password = strings.ToLower(password)
+	personal := []string{strings.ToLower(cake)}
+	if at := strings.LastIndex(email, "@"); at > 0 {
+		personal = append(personal, strings.ToLower(email[:at]))
+	}
+	for _, value := range personal {
+		// short values like "ab" would reject too many passwords
+		if utf8.RuneCountInString(value) >= 3 && strings.Contains(password, value) {
+			return true
+		}
+	}
+	return false
+}
+
+type BreachedPasswords interface {
+	IsBreached(password string) (bool, error)
+}
+
+// breachPrefixLength is the length of the SHA-1 prefix used as the file
+// name, as in the k-anonymity range API of Have I Been Pwned.
+const breachPrefixLength = 5
+
+// FileBreachIndex looks passwords up in a directory of files named by the
+// first 5 hex symbols of the SHA-1 of a password. Every file holds the
+// remaining 35 symbols of the hashes, one per line, optionally followed
+// by ":count". Only one small file is read for a lookup.
+type FileBreachIndex struct {
+	Dir string
+}
+
+func breachHash(password string) (string, string) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return hash[:breachPrefixLength], hash[breachPrefixLength:]
+}
+
+func (idx FileBreachIndex) IsBreached(password string) (bool, error) {
+	prefix, suffix := breachHash(password)
+	f, err := os.Open(filepath.Join(idx.Dir, prefix))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if colon := strings.Index(line, ":"); colon >= 0 {
+			line = line[:colon]
+		}
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// BuildBreachIndex writes an index for FileBreachIndex from a list of
+// leaked passwords, one per line.
+func BuildBreachIndex(dir string, passwords io.Reader) error {
+	ranges := make(map[string][]string)
+	scanner := bufio.NewScanner(passwords)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		prefix, suffix := breachHash(scanner.Text())
+		ranges[prefix] = append(ranges[prefix], suffix)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for prefix, suffixes := range ranges {
+		sort.Strings(suffixes)
+		data := strings.Join(suffixes, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(dir, prefix), []byte(data), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	codes := func(errs FieldErrors) string {
+		var result []string
+		for _, e := range errs {
+			result = append(result, e.Code)
+		}
+		return strings.Join(result, ",")
+	}
+	t.Run("rules", func(t *testing.T) {
+		policy := DefaultPasswordPolicy()
+		policy.RequireUpper = true
+		policy.RequireDigit = true
+		policy.RequireSymbol = true
+		cases := map[string]string{
+			"Good-pass42":              "",
+			"short":                    "min,password_upper,password_digit,password_symbol",
+			"Paaaaass-42":              "password_repeated",
+			"Pass-abcdef":              "password_digit,password_sequential",
+			"Pass-987654":              "password_sequential",
+			"Cheesecake-1":             "password_personal",
+			"My-Alice-pass1":           "password_personal",
+			strings.Repeat("Ab1-", 17): "max",
+		}
+		for password, expected := range cases {
+			errs, err := policy.Check(password, "alice@mail.com", "cheesecake")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := codes(errs); actual != expected {
+				t.Errorf("%q: expected %q, actual %q", password, expected, actual)
+			}
+		}
+	})
+	t.Run("breach index", func(t *testing.T) {
+		dir := t.TempDir()
+		err := BuildBreachIndex(dir, strings.NewReader("password1\nqwertyuiop\n\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		policy := DefaultPasswordPolicy()
+		policy.Breached = FileBreachIndex{Dir: dir}
+		for password, expected := range map[string]string{
+			"password1":  "password_breached",
+			"qwertyuiop": "password_breached",
+			"somepass":   "",
+		} {
+			errs, err := policy.Check(password, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := codes(errs); actual != expected {
+				t.Errorf("%q: expected %q, actual %q", password, expected, actual)
+			}
+		}
+	})
+}
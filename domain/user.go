@@ -0,0 +1,73 @@
+// Package domain has the types shared by the storage, auth and HTTP
+// packages: users, their ban history and the validation rules.
+package domain
+
+import (
+	"time"
+)
+
+type User struct {
+	Email          string
+	PasswordDigest string
+	FavoriteCake   string
+	Role           string
+	BanHistory     History
+	Ban            bool
+	// BanUntil is the end of a temporary ban, zero for a permanent one.
+	BanUntil time.Time
+	MFA      MFAState
+	// ServiceAccount users can't log in with a password, only with API keys.
+	ServiceAccount bool
+	// DeleteAfter is when the account of a user who asked for its
+	// deletion goes away, zero when no deletion is pending.
+	DeleteAfter time.Time
+	// DeletedAt is when an admin deleted the user and DeletedBy is the
+	// admin. Deleted users are kept as tombstones until they are purged.
+	DeletedAt time.Time
+	DeletedBy string
+	// Version is increased by the repository on every write.
+	Version int
+}
+
+// EffectiveRole is the role of the user, users without a role are plain users.
+func (u User) EffectiveRole() string {
+	if u.Role == "" {
+		return "UserRole"
+	}
+	return u.Role
+}
+
+// Deleted tells if the user is a tombstone left by an admin deletion.
+func (u User) Deleted() bool {
+	return !u.DeletedAt.IsZero()
+}
+
+// Banned tells if the user is banned at the given time, temporary bans
+// are over once BanUntil has passed.
+func (u User) Banned(now time.Time) bool {
+	return u.Ban && (u.BanUntil.IsZero() || now.Before(u.BanUntil))
+}
+
+type BanHistoryList struct {
+	Executor string
+	IsBan    bool
+	Time     time.Time
+	Reason   string
+	// Until is the end of a temporary ban.
+	Until time.Time
+}
+
+type History []BanHistoryList
+
+// MFAState is the two-factor authentication state of a user.
+type MFAState struct {
+	// Secret is the base32 TOTP secret. It is set on enrolment and
+	// becomes active once a code for it is confirmed.
+	Secret  string
+	Enabled bool
+	// LastStep is the TOTP time step of the last accepted code,
+	// older and equal steps are rejected to stop replays.
+	LastStep int64
+	// RecoveryCodes are SHA-256 hashes of the unused recovery codes.
+	RecoveryCodes []string
+}
@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldError is a problem with one field of the params. Code and Param
+// select the message in the catalogue, Message is already translated.
+type FieldError struct {
+	Field   string
+	Code    string
+	Param   string
+	Message string
+}
+
+func NewFieldError(field, code, param string) FieldError {
+	return FieldError{
+		Field:   field,
+		Code:    code,
+		Param:   param,
+		Message: Message(DefaultLanguage, field, code, param),
+	}
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		lines = append(lines, fieldErr.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rule checks a string value, it returns the code of the violation
+// or an empty string if the value is fine.
+type rule func(value, param string) string
+
+// rules are the names usable in `validate` struct tags, e.g.
+//
+//	Password string `json:"password" validate:"required,min=8,max=64"`
+//
+// Rules of a field run in order and stop at the first violation.
+// regex takes the rest of the tag as its pattern, so it has to be the last one.
+var rules = map[string]rule{
+	"required": func(value, _ string) string {
+		if strings.TrimSpace(value) == "" {
+			return "required"
+		}
+		return ""
+	},
+	"email": func(value, _ string) string {
+		if _, err := NormalizeEmail(value); err == ErrEmailDisplayName {
+			return "email_display_name"
+		} else if err != nil {
+			return "email"
+		}
+		return ""
+	},
+	"min": func(value, param string) string {
+		if n, _ := strconv.Atoi(param); utf8.RuneCountInString(value) < n {
+			return "min"
+		}
+		return ""
+	},
+	"max": func(value, param string) string {
+		if n, _ := strconv.Atoi(param); utf8.RuneCountInString(value) > n {
+			return "max"
+		}
+		return ""
+	},
+	"charset": func(value, param string) string {
+		allowed := charsets[param]
+		for _, c := range value {
+			if !allowed(c) {
+				return "charset"
+			}
+		}
+		return ""
+	},
+	"oneof": func(value, param string) string {
+		for _, option := range strings.Fields(param) {
+			if value == option {
+				return ""
+			}
+		}
+		return "oneof"
+	},
+	"regex": func(value, param string) string {
+		if !compileRegex(param).MatchString(value) {
+			return "regex"
+		}
+		return ""
+	},
+}
+
+var charsets = map[string]func(rune) bool{
+	"alpha": unicode.IsLetter,
+	"alnum": func(c rune) bool { return unicode.IsLetter(c) || unicode.IsDigit(c) },
+	"digit": unicode.IsDigit,
+	"ascii": func(c rune) bool { return c < utf8.RuneSelf },
+}
+
+var regexCache sync.Map
+
+func compileRegex(pattern string) *regexp.Regexp {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	regexCache.Store(pattern, re)
+	return re
+}
+
+type fieldRule struct {
+	name  string
+	param string
+}
+
+func parseRules(tag string) []fieldRule {
+	var result []fieldRule
+	for tag != "" {
+		part := tag
+		if !strings.HasPrefix(tag, "regex=") {
+			if comma := strings.Index(tag, ","); comma >= 0 {
+				part, tag = tag[:comma], tag[comma+1:]
+			} else {
+				tag = ""
+			}
+		} else {
+			tag = ""
+		}
+		name, param := part, ""
+		if eq := strings.Index(part, "="); eq >= 0 {
+			name, param = part[:eq], part[eq+1:]
+		}
+		if _, ok := rules[name]; !ok {
+			panic(fmt.Sprintf("unknown validation rule %q", name))
+		}
+		if name == "charset" && charsets[param] == nil {
+			panic(fmt.Sprintf("unknown charset %q", param))
+		}
+		result = append(result, fieldRule{name, param})
+	}
+	return result
+}
+
+// Validate checks the string fields of a params struct against their
+// `validate` tags and returns every violation, nil if there are none.
+func Validate(params interface{}) FieldErrors {
+	v := reflect.Indirect(reflect.ValueOf(params))
+	t := v.Type()
+	var errs FieldErrors
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || field.Type.Kind() != reflect.String {
+			continue
+		}
+		name, _ := JSONFieldName(field)
+		value := v.Field(i).String()
+		for _, r := range parseRules(tag) {
+			if code := rules[r.name](value, r.param); code != "" {
+				errs = append(errs, NewFieldError(name, code, r.param))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// JSONFieldName returns the name of a field in JSON and the options of
+// its json tag, e.g. ",omitempty".
+func JSONFieldName(field reflect.StructField) (string, string) {
+	tag := field.Tag.Get("json")
+	name, opts := tag, ""
+	if comma := strings.Index(tag, ","); comma >= 0 {
+		name, opts = tag[:comma], tag[comma:]
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, opts
+}
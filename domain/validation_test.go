@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"testing"
+)
+
+type testValidationParams struct {
+	Name  string `json:"name" validate:"required,min=2,max=5,charset=alpha"`
+	Kind  string `json:"kind" validate:"oneof=cake pie"`
+	Code  string `json:"code" validate:"regex=^[A-Z]{2,3}$"`
+	Email string `json:"email" validate:"email"`
+	Free  string `json:"free"`
+}
+
+func TestValidation(t *testing.T) {
+	t.Run("valid params", func(t *testing.T) {
+		params := testValidationParams{Name: "Käse", Kind: "pie", Code: "ABC", Email: "a@b.c"}
+		if errs := Validate(&params); errs != nil {
+			t.Error("unexpected errors", errs)
+		}
+	})
+	t.Run("all violations at once", func(t *testing.T) {
+		params := testValidationParams{Name: "Cake1", Kind: "bun", Code: "A,B", Email: "Name <a@b.c>"}
+		errs := Validate(params)
+		codes := map[string]string{}
+		for _, e := range errs {
+			codes[e.Field] = e.Code
+		}
+		expected := map[string]string{
+			"name":  "charset",
+			"kind":  "oneof",
+			"code":  "regex",
+			"email": "email_display_name",
+		}
+		if len(codes) != len(expected) {
+			t.Fatal("unexpected errors", errs)
+		}
+		for field, code := range expected {
+			if codes[field] != code {
+				t.Errorf("%s: expected %s, actual %s", field, code, codes[field])
+			}
+		}
+	})
+	t.Run("first rule of a field wins", func(t *testing.T) {
+		errs := Validate(testValidationParams{Kind: "cake", Code: "AB", Email: "a@b.c"})
+		if len(errs) != 1 || errs[0].Code != "required" || errs[0].Error() != "The name field is required!" {
+			t.Error("unexpected errors", errs)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+// Package events is the in-process event bus of the API. The service
+// publishes what happened to users, transports subscribe to stream it to
+// clients. Recent events are kept in a bounded buffer so clients that
+// reconnect can resume where they stopped.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Types of events.
+const (
+	UserRegistered  = "user.registered"
+	UserBanned      = "user.banned"
+	UserUnbanned    = "user.unbanned"
+	ProfileUpdated  = "user.profile_updated"
+	PasswordChanged = "user.password_changed"
+	EmailChanged    = "user.email_changed"
+	UserDeleted     = "user.deleted"
+	UserRestored    = "user.restored"
+	UserPurged      = "user.purged"
+	// AccountClosed is the purge of an account the user asked to delete,
+	// after the grace period. UserDeleted and UserPurged are what admins do.
+	AccountClosed = "user.account_closed"
+)
+
+// Types are all types of events, in the order they were added.
+var Types = []string{UserRegistered, UserBanned, UserUnbanned, ProfileUpdated, PasswordChanged, EmailChanged, UserDeleted, UserRestored, UserPurged, AccountClosed}
+
+const (
+	DefaultBufferSize = 1000
+	// subscriptionBuffer is how far a subscriber may fall behind
+	subscriptionBuffer = 64
+)
+
+// Event is something that happened to the user with Email. Actor is who
+// did it when it was not the user, for example the admin of a ban.
+// PreviousEmail is set when the email changed.
+type Event struct {
+	ID            uint64    `json:"id"`
+	Type          string    `json:"type"`
+	Email         string    `json:"email"`
+	PreviousEmail string    `json:"previous_email,omitempty"`
+	Actor         string    `json:"actor,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// Anonymize returns the event with alias wherever it had email.
+func (e Event) Anonymize(email, alias string) Event {
+	if e.Email == email {
+		e.Email = alias
+	}
+	if e.PreviousEmail == email {
+		e.PreviousEmail = alias
+	}
+	if e.Actor == email {
+		e.Actor = alias
+	}
+	return e
+}
+
+// Subscription receives the events a subscriber matches. C is closed when
+// the subscriber falls behind or unsubscribes, a subscriber that was too
+// slow resumes with Subscribe from the last event it got.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	match func(Event) bool
+}
+
+type Bus struct {
+	lock        sync.Mutex
+	lastID      uint64
+	buffer      []Event
+	size        int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBus returns a bus that keeps the last size events for replay.
+func NewBus(size int) *Bus {
+	return &Bus{
+		size:        size,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish numbers the event and sends it to the matching subscribers. It
+// never blocks on a subscriber.
+func (b *Bus) Publish(e Event) Event {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(b.buffer) == b.size {
+		b.buffer = append(b.buffer[:0], b.buffer[1:]...)
+	}
+	b.buffer = append(b.buffer, e)
+
+	for s := range b.subscribers {
+		if !s.match(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			b.drop(s)
+		}
+	}
+	return e
+}
+
+// Subscribe returns a subscription to the next events that match.
+func (b *Bus) Subscribe(match func(Event) bool) *Subscription {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.subscribe(match)
+}
+
+// Resume is Subscribe for a subscriber that got the events up to lastID.
+// It also returns the buffered events after lastID that match, complete
+// is false when some of them were already dropped from the buffer.
+func (b *Bus) Resume(lastID uint64, match func(Event) bool) (s *Subscription, replay []Event, complete bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	complete = lastID >= b.lastID || (len(b.buffer) > 0 && b.buffer[0].ID <= lastID+1)
+	for _, e := range b.buffer {
+		if e.ID > lastID && match(e) {
+			replay = append(replay, e)
+		}
+	}
+	return b.subscribe(match), replay, complete
+}
+
+// Anonymize replaces email with alias in the buffered events, so replays
+// don't bring back the email of a purged user.
+func (b *Bus) Anonymize(email, alias string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i := range b.buffer {
+		b.buffer[i] = b.buffer[i].Anonymize(email, alias)
+	}
+}
+
+func (b *Bus) subscribe(match func(Event) bool) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, match: match}
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+func (b *Bus) Unsubscribe(s *Subscription) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.drop(s)
+}
+
+func (b *Bus) drop(s *Subscription) {
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.c)
+	}
+}
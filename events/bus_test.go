@@ -0,0 +1,63 @@
+package events
+
+import "testing"
+
+func all(Event) bool { return true }
+
+func TestBus(t *testing.T) {
+	t.Run("publish and resume", func(t *testing.T) {
+		b := NewBus(3)
+		s := b.Subscribe(func(e Event) bool { return e.Email == "test@mail.com" })
+		b.Publish(Event{Type: UserRegistered, Email: "other@mail.com"})
+		b.Publish(Event{Type: UserBanned, Email: "test@mail.com"})
+		if e := <-s.C; e.ID != 2 || e.Type != UserBanned || e.Time.IsZero() {
+			t.Error("unexpected event", e)
+		}
+		b.Unsubscribe(s)
+		if _, ok := <-s.C; ok {
+			t.Error("subscription is still open")
+		}
+
+		b.Publish(Event{Type: UserUnbanned, Email: "test@mail.com"})
+		_, replay, complete := b.Resume(1, all)
+		if len(replay) != 2 || replay[0].ID != 2 || !complete {
+			t.Error("unexpected replay", replay, complete)
+		}
+		b.Publish(Event{Type: ProfileUpdated, Email: "test@mail.com"})
+		_, replay, complete = b.Resume(0, all)
+		if len(replay) != 3 || replay[0].ID != 2 || complete {
+			t.Error("unexpected replay of dropped events", replay, complete)
+		}
+		_, replay, complete = b.Resume(4, all)
+		if len(replay) != 0 || !complete {
+			t.Error("unexpected replay of the last event", replay, complete)
+		}
+	})
+
+	t.Run("anonymize", func(t *testing.T) {
+		b := NewBus(DefaultBufferSize)
+		b.Publish(Event{Type: UserBanned, Email: "test@mail.com", Actor: "admin@mail.com"})
+		b.Publish(Event{Type: EmailChanged, Email: "new@mail.com", PreviousEmail: "admin@mail.com"})
+		b.Anonymize("admin@mail.com", "deleted-user-1")
+		_, replay, _ := b.Resume(0, all)
+		if replay[0].Actor != "deleted-user-1" || replay[0].Email != "test@mail.com" || replay[1].PreviousEmail != "deleted-user-1" {
+			t.Error("unexpected replay", replay)
+		}
+	})
+
+	t.Run("slow subscribers are dropped", func(t *testing.T) {
+		b := NewBus(DefaultBufferSize)
+		s := b.Subscribe(all)
+		for i := 0; i <= subscriptionBuffer; i++ {
+			b.Publish(Event{Type: ProfileUpdated, Email: "test@mail.com"})
+		}
+		n := 0
+		for range s.C {
+			n++
+		}
+		if n != subscriptionBuffer {
+			t.Error("unexpected number of events", n)
+		}
+		b.Unsubscribe(s)
+	})
+}
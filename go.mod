@@ -2,8 +2,19 @@ module golang-api
 
 go 1.17
 
+require (
+	github.com/graphql-go/graphql v0.8.1
+	golang.org/x/net v0.17.0
+	google.golang.org/grpc v1.56.3
+	google.golang.org/protobuf v1.30.0
+)
+
 require (
 	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/openware/rango v0.0.0-20210909144821-b2239c24555b // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
 )
@@ -0,0 +1,135 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+
+	"golang-api/storage"
+)
+
+// Limits stop queries that would be too expensive to run. Depth counts
+// nested fields. Complexity counts fields, the fields under a list count
+// once per item: `first` items for paged fields, ListSize for the others.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+	ListSize      int
+}
+
+func DefaultLimits() Limits {
+	return Limits{MaxDepth: 6, MaxComplexity: 500, ListSize: 10}
+}
+
+// listFields are the fields returning lists with the default number of
+// items they are counted with.
+var listFields = map[string]func(Limits) int{
+	"users":      func(Limits) int { return storage.DefaultPageLimit },
+	"banHistory": func(l Limits) int { return l.ListSize },
+}
+
+type limitChecker struct {
+	limits    Limits
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// spreads are the fragments being walked, cycles are left to validation
+	spreads map[string]bool
+}
+
+func (l Limits) check(doc *ast.Document, variables map[string]interface{}) error {
+	c := &limitChecker{
+		limits:    l,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		spreads:   make(map[string]bool),
+	}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			c.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		depth, complexity := c.selectionSet(op.SelectionSet)
+		if depth > l.MaxDepth {
+			return fmt.Errorf("query depth %d is over the limit of %d", depth, l.MaxDepth)
+		}
+		if complexity > l.MaxComplexity {
+			return fmt.Errorf("query complexity %d is over the limit of %d", complexity, l.MaxComplexity)
+		}
+	}
+	return nil
+}
+
+// selectionSet returns the depth and the complexity of the selections.
+// Introspection fields are free, their size is bound by the schema.
+func (c *limitChecker) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	maxDepth, complexity := 0, 0
+	add := func(depth, cost int) {
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		complexity += cost
+	}
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			depth, cost := c.selectionSet(s.SelectionSet)
+			add(depth+1, 1+c.items(s)*cost)
+		case *ast.InlineFragment:
+			add(c.selectionSet(s.SelectionSet))
+		case *ast.FragmentSpread:
+			fragment, ok := c.fragments[s.Name.Value]
+			if !ok || c.spreads[s.Name.Value] {
+				continue
+			}
+			c.spreads[s.Name.Value] = true
+			add(c.selectionSet(fragment.SelectionSet))
+			delete(c.spreads, s.Name.Value)
+		}
+	}
+	return maxDepth, complexity
+}
+
+// items is how many times the selections of a field are resolved.
+func (c *limitChecker) items(field *ast.Field) int {
+	items, ok := listFields[field.Name.Value]
+	if !ok {
+		return 1
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name.Value == "first" {
+			if first, ok := c.intValue(arg.Value); ok && first > 0 {
+				return first
+			}
+		}
+	}
+	return items(c.limits)
+}
+
+func (c *limitChecker) intValue(value ast.Value) (int, bool) {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		return n, err == nil
+	case *ast.Variable:
+		switch n := c.variables[v.Name.Value].(type) {
+		case float64:
+			return int(n), true
+		case int:
+			return n, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,249 @@
+// Package graphqlapi is the GraphQL schema of the API for the admin
+// dashboard. Fields are authorized one by one with the role model of the
+// HTTP API, the caller is the principal in the context of the request.
+package graphqlapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/service"
+	"golang-api/storage"
+)
+
+// Request is a GraphQL request as clients send it over HTTP.
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+type Schema struct {
+	schema graphql.Schema
+	users  *service.Users
+	limits Limits
+}
+
+// authorized wraps a resolver with the role check of the field. Queries
+// are reads and mutations writes for the scopes of API keys.
+func authorized(role, method string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		principal, ok := auth.PrincipalFrom(p.Context)
+		if !ok {
+			return nil, auth.ErrUnauthorized
+		}
+		if err := principal.Authorize(role, method); err != nil {
+			return nil, err
+		}
+		return resolve(p)
+	}
+}
+
+func viewer(ctx context.Context) domain.User {
+	p, _ := auth.PrincipalFrom(ctx)
+	return p.User
+}
+
+func formatTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+var banEventType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "BanEvent",
+	Fields: graphql.Fields{
+		"executor": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.BanHistoryList).Executor, nil
+		}},
+		"banned": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.BanHistoryList).IsBan, nil
+		}},
+		"reason": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.BanHistoryList).Reason, nil
+		}},
+		"time": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return formatTime(p.Source.(domain.BanHistoryList).Time), nil
+		}},
+		"until": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return formatTime(p.Source.(domain.BanHistoryList).Until), nil
+		}},
+	},
+})
+
+var userType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"email": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.User).Email, nil
+		}},
+		"favoriteCake": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.User).FavoriteCake, nil
+		}},
+		"role": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.User).EffectiveRole(), nil
+		}},
+		"banned": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.User).Banned(time.Now()), nil
+		}},
+		"version": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(domain.User).Version, nil
+		}},
+		// who banned a user and why is for admins only, even on the viewer
+		"banHistory": &graphql.Field{
+			Type: graphql.NewList(graphql.NewNonNull(banEventType)),
+			Resolve: authorized("AdminRole", http.MethodGet, func(p graphql.ResolveParams) (interface{}, error) {
+				return []domain.BanHistoryList(p.Source.(domain.User).BanHistory), nil
+			}),
+		},
+	},
+})
+
+var userPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserPage",
+	Fields: graphql.Fields{
+		"nodes": &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(userType)), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(storage.UserPage).Users, nil
+		}},
+		"nextCursor": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if cursor := p.Source.(storage.UserPage).NextCursor; cursor != "" {
+				return cursor, nil
+			}
+			return nil, nil
+		}},
+	},
+})
+
+// NewSchema builds the schema over the rules of users.
+func NewSchema(users *service.Users, limits Limits) (*Schema, error) {
+	s := &Schema{users: users, limits: limits}
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    s.queryType(),
+		Mutation: s.mutationType(),
+	})
+	s.schema = schema
+	return s, err
+}
+
+func (s *Schema) queryType() *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"viewer": &graphql.Field{
+				Type: userType,
+				Resolve: authorized("UserRole", http.MethodGet, func(p graphql.ResolveParams) (interface{}, error) {
+					return viewer(p.Context), nil
+				}),
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: authorized("AdminRole", http.MethodGet, func(p graphql.ResolveParams) (interface{}, error) {
+					email, err := domain.NormalizeEmail(p.Args["email"].(string))
+					if err != nil {
+						return nil, err
+					}
+					return s.users.Repository().Get(p.Context, email)
+				}),
+			},
+			"users": &graphql.Field{
+				Type: userPageType,
+				Args: graphql.FieldConfigArgument{
+					"role":          &graphql.ArgumentConfig{Type: graphql.String},
+					"banned":        &graphql.ArgumentConfig{Type: graphql.Boolean},
+					"emailPrefix":   &graphql.ArgumentConfig{Type: graphql.String},
+					"emailContains": &graphql.ArgumentConfig{Type: graphql.String},
+					"favoriteCake":  &graphql.ArgumentConfig{Type: graphql.String},
+					"first":         &graphql.ArgumentConfig{Type: graphql.Int},
+					"after":         &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: authorized("AdminRole", http.MethodGet, func(p graphql.ResolveParams) (interface{}, error) {
+					filter := storage.UserFilter{}
+					filter.Role, _ = p.Args["role"].(string)
+					filter.EmailPrefix, _ = p.Args["emailPrefix"].(string)
+					filter.EmailContains, _ = p.Args["emailContains"].(string)
+					filter.FavoriteCake, _ = p.Args["favoriteCake"].(string)
+					if banned, ok := p.Args["banned"].(bool); ok {
+						filter.Banned = &banned
+					}
+					page := storage.Page{}
+					page.Cursor, _ = p.Args["after"].(string)
+					page.Limit, _ = p.Args["first"].(int)
+					return s.users.Repository().List(p.Context, filter, page)
+				}),
+			},
+		},
+	})
+}
+
+func (s *Schema) mutationType() *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"ban": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"email":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"reason":       &graphql.ArgumentConfig{Type: graphql.String},
+					"durationDays": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: authorized("AdminRole", http.MethodPost, func(p graphql.ResolveParams) (interface{}, error) {
+					reason, _ := p.Args["reason"].(string)
+					var until time.Time
+					if days, _ := p.Args["durationDays"].(int); days != 0 {
+						until = time.Now().AddDate(0, 0, days)
+					}
+					return s.users.Ban(p.Context, viewer(p.Context), p.Args["email"].(string), reason, until)
+				}),
+			},
+			"unban": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: authorized("AdminRole", http.MethodPost, func(p graphql.ResolveParams) (interface{}, error) {
+					return s.users.Unban(p.Context, viewer(p.Context), p.Args["email"].(string))
+				}),
+			},
+			"updateFavoriteCake": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"favoriteCake": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: authorized("UserRole", http.MethodPost, func(p graphql.ResolveParams) (interface{}, error) {
+					return s.users.UpdateProfile(p.Context, viewer(p.Context).Email,
+						service.ProfileParams{FavoriteCake: p.Args["favoriteCake"].(string)})
+				}),
+			},
+		},
+	})
+}
+
+// Execute runs a request as the principal in ctx. Requests over the depth
+// or complexity limits are rejected before anything is resolved.
+func (s *Schema) Execute(ctx context.Context, req Request) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if err := s.limits.check(doc, req.Variables); err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	return graphql.Do(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+}
@@ -0,0 +1,103 @@
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/service"
+	"golang-api/storage"
+)
+
+type nopMailer struct{}
+
+func (nopMailer) Send(to, subject, body string) error { return nil }
+
+func newTestSchema(t *testing.T, limits Limits) (*Schema, domain.User, domain.User) {
+	users := service.NewUsers(storage.FromLegacy(storage.NewInMemoryUserStorage()), nopMailer{}, domain.DefaultPasswordPolicy())
+	ctx := context.Background()
+	user, err := users.Register(ctx, service.RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.AddAdmin(ctx, "admin@mail.com", "adminadmin")
+	admin, _ := users.Repository().Get(ctx, "admin@mail.com")
+	schema, err := NewSchema(users, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema, user, admin
+}
+
+// run executes the query as the principal and returns the result as JSON.
+func run(s *Schema, p *auth.Principal, query string, variables map[string]interface{}) string {
+	ctx := context.Background()
+	if p != nil {
+		ctx = auth.WithPrincipal(ctx, *p)
+	}
+	result, _ := json.Marshal(s.Execute(ctx, Request{Query: query, Variables: variables}))
+	return string(result)
+}
+
+func assertContains(t *testing.T, expected, actual string) {
+	t.Helper()
+	if !strings.Contains(actual, expected) {
+		t.Errorf("Expected %s in %s", expected, actual)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	t.Run("viewer", func(t *testing.T) {
+		s, user, _ := newTestSchema(t, DefaultLimits())
+		assertContains(t, `"message":"unauthorized"`, run(s, nil, `{ viewer { email } }`, nil))
+
+		p := &auth.Principal{User: user}
+		assertContains(t, `{"data":{"viewer":{"email":"test@mail.com","favoriteCake":"cheesecake"}}}`,
+			run(s, p, `{ viewer { email favoriteCake } }`, nil))
+
+		// the rest of the viewer resolves, only the admin field fails
+		resp := run(s, p, `{ viewer { email banHistory { reason } } }`, nil)
+		assertContains(t, `"viewer":{"banHistory":null,"email":"test@mail.com"}`, resp)
+		assertContains(t, `"message":"permission denied"`, resp)
+
+		assertContains(t, `"message":"permission denied"`, run(s, p, `{ user(email: "admin@mail.com") { email } }`, nil))
+		assertContains(t, `"message":"permission denied"`, run(s, p, `mutation { unban(email: "test@mail.com") { banned } }`, nil))
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		s, _, admin := newTestSchema(t, DefaultLimits())
+		assertContains(t, `"message":"two-factor authentication required"`,
+			run(s, &auth.Principal{User: admin}, `{ users { nodes { email } } }`, nil))
+
+		p := &auth.Principal{User: admin, Level: auth.LevelMFA}
+		resp := run(s, p, `mutation($email: String!) { ban(email: $email, reason: "making mess", durationDays: 1) { banned } }`,
+			map[string]interface{}{"email": "Test@mail.com"})
+		assertContains(t, `{"data":{"ban":{"banned":true}}}`, resp)
+
+		resp = run(s, p, `{ user(email: "test@mail.com") { banHistory { executor reason until } } }`, nil)
+		assertContains(t, `"executor":"admin@mail.com","reason":"making mess","until":"`, resp)
+
+		resp = run(s, p, `query($first: Int) { users(first: $first, banned: true) { nodes { email } nextCursor } }`,
+			map[string]interface{}{"first": float64(1)})
+		assertContains(t, `{"data":{"users":{"nextCursor":null,"nodes":[{"email":"test@mail.com"}]}}}`, resp)
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		s, user, _ := newTestSchema(t, Limits{MaxDepth: 3, MaxComplexity: 30, ListSize: 10})
+		p := &auth.Principal{User: user}
+		assertContains(t, `"message":"query depth 4 is over the limit of 3"`,
+			run(s, p, `{ users { nodes { banHistory { reason } } } }`, nil))
+		assertContains(t, `"message":"query depth 4 is over the limit of 3"`,
+			run(s, p, `{ ...u } fragment u on Query { users { nodes { ...h } } } fragment h on User { banHistory { reason } }`, nil))
+		// 1 + 20 users * (1 + 1) fields
+		assertContains(t, `"message":"query complexity 41 is over the limit of 30"`,
+			run(s, p, `{ users { nodes { email } } }`, nil))
+		assertContains(t, `"message":"query complexity 11 is over the limit of 10"`,
+			run(&Schema{schema: s.schema, limits: Limits{MaxDepth: 5, MaxComplexity: 10}}, p, `{ users(first: 5) { nodes { email } } }`, nil))
+		assertContains(t, `{"data":{"viewer":{"email":"test@mail.com"}}}`, run(s, p, `{ viewer { email } }`, nil))
+		assertContains(t, `"__schema"`, run(s, p, `{ __schema { types { name fields { name type { name ofType { name } } } } } }`, nil))
+	})
+}
@@ -0,0 +1,79 @@
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"golang-api/auth"
+)
+
+// Client calls the services of NewServer for Go programs, other languages
+// call the same methods with JSON messages.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// WithToken returns a context whose calls are authenticated with a session
+// token from Login or an API key ("ApiKey cake_...").
+func WithToken(ctx context.Context, token string) context.Context {
+	if !strings.HasPrefix(token, auth.APIKeyAuthScheme) {
+		token = "Bearer " + token
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", token)
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	return c.conn.Invoke(ctx, method, req, resp, grpc.ForceCodec(jsonCodec{}))
+}
+
+func (c *Client) Register(ctx context.Context, req *RegisterRequest) (*User, error) {
+	resp := &User{}
+	return resp, c.invoke(ctx, "/cake.Users/Register", req, resp)
+}
+
+func (c *Client) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
+	resp := &LoginResponse{}
+	return resp, c.invoke(ctx, "/cake.Users/Login", req, resp)
+}
+
+func (c *Client) LoginMFA(ctx context.Context, req *MFALoginRequest) (*LoginResponse, error) {
+	resp := &LoginResponse{}
+	return resp, c.invoke(ctx, "/cake.Users/LoginMFA", req, resp)
+}
+
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	resp := &User{}
+	return resp, c.invoke(ctx, "/cake.Users/Me", &Empty{}, resp)
+}
+
+func (c *Client) UpdateProfile(ctx context.Context, req *UpdateProfileRequest) (*User, error) {
+	resp := &User{}
+	return resp, c.invoke(ctx, "/cake.Users/UpdateProfile", req, resp)
+}
+
+func (c *Client) ChangePassword(ctx context.Context, req *ChangePasswordRequest) (*User, error) {
+	resp := &User{}
+	return resp, c.invoke(ctx, "/cake.Users/ChangePassword", req, resp)
+}
+
+func (c *Client) Ban(ctx context.Context, req *BanRequest) (*User, error) {
+	resp := &User{}
+	return resp, c.invoke(ctx, "/cake.Admin/Ban", req, resp)
+}
+
+func (c *Client) Unban(ctx context.Context, req *UnbanRequest) (*User, error) {
+	resp := &User{}
+	return resp, c.invoke(ctx, "/cake.Admin/Unban", req, resp)
+}
+
+func (c *Client) GetUser(ctx context.Context, req *GetUserRequest) (*User, error) {
+	resp := &User{}
+	return resp, c.invoke(ctx, "/cake.Admin/GetUser", req, resp)
+}
@@ -0,0 +1,45 @@
+package grpcapi
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// codecName is the content subtype of the API.
+//
+// The wire format is plain gRPC over HTTP/2 with JSON messages instead
+// of protobuf: requests have the content type application/grpc+json and
+// every message is a JSON object with the fields of the structs in
+// messages.go, named as in the HTTP API. The methods are unary and named
+// /cake.Users/<Name> and /cake.Admin/<Name> after userMethods and
+// adminMethods. Errors are gRPC status codes, see statusError.
+//
+// Server reflection speaks protobuf, the codec encodes protobuf messages
+// as such so it works next to the JSON services. Its descriptors are in
+// schemaFiles.
+//
+// The codec is not put into the gRPC registry, NewServer and Client set
+// it on their own calls only, so importing this package changes nothing
+// for other gRPC users of the process.
+const codecName = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
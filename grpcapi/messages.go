@@ -0,0 +1,104 @@
+package grpcapi
+
+import (
+	"time"
+
+	"golang-api/domain"
+)
+
+type Empty struct{}
+
+type RegisterRequest struct {
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	FavoriteCake string `json:"favorite_cake"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LoginResponse has the session token, or the token for LoginMFA when
+// the user has two-factor authentication.
+type LoginResponse struct {
+	Token       string `json:"token,omitempty"`
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// Version in the requests below works like If-Match in the HTTP API, the
+// call fails unless the user still has it. 0 skips the check.
+
+type UpdateProfileRequest struct {
+	FavoriteCake string `json:"favorite_cake"`
+	Version      int    `json:"version,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	Password string `json:"password"`
+	Version  int    `json:"version,omitempty"`
+}
+
+type BanRequest struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason,omitempty"`
+	// DurationDays is the length of the ban, 0 bans the user until unbanned.
+	DurationDays int `json:"duration_days,omitempty"`
+	Version      int `json:"version,omitempty"`
+}
+
+type UnbanRequest struct {
+	Email   string `json:"email"`
+	Version int    `json:"version,omitempty"`
+}
+
+type GetUserRequest struct {
+	Email string `json:"email"`
+}
+
+type BanEvent struct {
+	Executor string `json:"executor"`
+	Banned   bool   `json:"banned"`
+	Reason   string `json:"reason,omitempty"`
+	// Time and Until are in RFC 3339 format
+	Time  string `json:"time"`
+	Until string `json:"until,omitempty"`
+}
+
+type User struct {
+	Email        string     `json:"email"`
+	FavoriteCake string     `json:"favorite_cake"`
+	Role         string     `json:"role"`
+	Banned       bool       `json:"banned"`
+	BanHistory   []BanEvent `json:"ban_history,omitempty"`
+	Version      int        `json:"version"`
+}
+
+func newUser(u domain.User) *User {
+	user := &User{
+		Email:        u.Email,
+		FavoriteCake: u.FavoriteCake,
+		Role:         u.EffectiveRole(),
+		Banned:       u.Banned(time.Now()),
+		Version:      u.Version,
+	}
+	for _, event := range u.BanHistory {
+		banEvent := BanEvent{
+			Executor: event.Executor,
+			Banned:   event.IsBan,
+			Reason:   event.Reason,
+			Time:     event.Time.UTC().Format(time.RFC3339),
+		}
+		if !event.Until.IsZero() {
+			banEvent.Until = event.Until.UTC().Format(time.RFC3339)
+		}
+		user.BanHistory = append(user.BanHistory, banEvent)
+	}
+	return user
+}
@@ -0,0 +1,105 @@
+package grpcapi
+
+import (
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// schemaFiles has the services as protobuf descriptors, server reflection
+// answers with them so tools can list and describe the methods. They are
+// built from the method tables and the structs in messages.go, the field
+// names are the JSON names and numbers follow the order of the struct
+// fields. Only the names matter on the wire, messages are JSON.
+var schemaFiles = schema()
+
+func schema() *protoregistry.Files {
+	b := schemaBuilder{
+		file: &descriptorpb.FileDescriptorProto{
+			Name:    proto.String("cake.proto"),
+			Package: proto.String("cake"),
+			Syntax:  proto.String("proto3"),
+		},
+		seen: map[reflect.Type]bool{},
+	}
+	b.service("Users", userMethods)
+	b.service("Admin", adminMethods)
+	fd, err := protodesc.NewFile(b.file, nil)
+	if err != nil {
+		panic("grpcapi: invalid schema: " + err.Error())
+	}
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(fd); err != nil {
+		panic("grpcapi: invalid schema: " + err.Error())
+	}
+	return files
+}
+
+type schemaBuilder struct {
+	file *descriptorpb.FileDescriptorProto
+	seen map[reflect.Type]bool
+}
+
+func (b *schemaBuilder) service(name string, methods []method) {
+	svc := &descriptorpb.ServiceDescriptorProto{Name: proto.String(name)}
+	for _, m := range methods {
+		svc.Method = append(svc.Method, &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(m.Name),
+			InputType:  proto.String(b.message(reflect.TypeOf(m.newRequest()))),
+			OutputType: proto.String(b.message(reflect.TypeOf(m.response))),
+		})
+	}
+	b.file.Service = append(b.file.Service, svc)
+}
+
+// message adds the descriptor of a message struct once and returns its
+// full name.
+func (b *schemaBuilder) message(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fullName := ".cake." + t.Name()
+	if b.seen[t] {
+		return fullName
+	}
+	b.seen[t] = true
+	msg := &descriptorpb.DescriptorProto{Name: proto.String(t.Name())}
+	b.file.MessageType = append(b.file.MessageType, msg)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		field := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(int32(len(msg.Field) + 1)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Slice {
+			field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.String:
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+		case reflect.Bool:
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum()
+		case reflect.Int:
+			// int32, proto3 JSON writes 64-bit integers as strings
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum()
+		case reflect.Struct:
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			field.TypeName = proto.String(b.message(ft))
+		default:
+			panic("grpcapi: no protobuf type for " + ft.String())
+		}
+		msg.Field = append(msg.Field, field)
+	}
+	return fullName
+}
@@ -0,0 +1,313 @@
+// Package grpcapi is the gRPC transport of the API for internal services.
+// It has the cake.Users and cake.Admin services over the same rules as
+// the HTTP API. The messages are the Go structs of this package encoded
+// as JSON, codecName has the details of the wire format for clients in
+// other languages. Server reflection describes the services and messages
+// as protobuf, see schemaFiles.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/service"
+	"golang-api/storage"
+)
+
+type Server struct {
+	users *service.Users
+	jwt   *auth.JWTService
+}
+
+// access is who may call a method. Method is the HTTP method of the
+// matching route, API key scopes are checked against it. Session methods
+// manage credentials, API keys can't call them.
+type access struct {
+	Role    string
+	Method  string
+	Session bool
+}
+
+type method struct {
+	Name   string
+	Access access
+	// newRequest makes the request message to decode the call into.
+	newRequest func() interface{}
+	// response is the message the call returns, for the schema.
+	response interface{}
+	call     func(s *Server, ctx context.Context, req interface{}) (interface{}, error)
+}
+
+var (
+	public      = access{}
+	userRead    = access{"UserRole", http.MethodGet, false}
+	userWrite   = access{"UserRole", http.MethodPut, false}
+	userSession = access{"UserRole", http.MethodPut, true}
+	adminRead   = access{"AdminRole", http.MethodGet, false}
+	adminBan    = access{"AdminRole", http.MethodPost, false}
+)
+
+var userMethods = []method{
+	{"Register", public, func() interface{} { return &RegisterRequest{} }, &User{}, (*Server).register},
+	{"Login", public, func() interface{} { return &LoginRequest{} }, &LoginResponse{}, (*Server).login},
+	{"LoginMFA", public, func() interface{} { return &MFALoginRequest{} }, &LoginResponse{}, (*Server).loginMFA},
+	{"Me", userRead, func() interface{} { return &Empty{} }, &User{}, (*Server).me},
+	{"UpdateProfile", userWrite, func() interface{} { return &UpdateProfileRequest{} }, &User{}, (*Server).updateProfile},
+	{"ChangePassword", userSession, func() interface{} { return &ChangePasswordRequest{} }, &User{}, (*Server).changePassword},
+}
+
+var adminMethods = []method{
+	{"Ban", adminBan, func() interface{} { return &BanRequest{} }, &User{}, (*Server).ban},
+	{"Unban", adminBan, func() interface{} { return &UnbanRequest{} }, &User{}, (*Server).unban},
+	{"GetUser", adminRead, func() interface{} { return &GetUserRequest{} }, &User{}, (*Server).getUser},
+}
+
+// methodAccess is filled from the method tables by serviceDesc.
+var methodAccess = map[string]access{}
+
+func serviceDesc(name string, methods []method) *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{
+		ServiceName: name,
+		HandlerType: (*interface{})(nil),
+	}
+	for _, m := range methods {
+		m, fullMethod := m, "/"+name+"/"+m.Name
+		methodAccess[fullMethod] = m.Access
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: m.Name,
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := m.newRequest()
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return m.call(srv.(*Server), ctx, req)
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, handler)
+			},
+		})
+	}
+	return desc
+}
+
+var (
+	usersServiceDesc = serviceDesc("cake.Users", userMethods)
+	adminServiceDesc = serviceDesc("cake.Admin", adminMethods)
+)
+
+// NewServer returns a gRPC server with the user and admin services.
+// Credentials come in the authorization metadata, the same bearer tokens
+// and API keys as the Authorization header of the HTTP API. Messages are
+// always JSON, whatever the content subtype of the call says. Reflection
+// is registered too and needs no credentials.
+func NewServer(users *service.Users, jwtService *auth.JWTService, opts ...grpc.ServerOption) *grpc.Server {
+	s := &Server{users: users, jwt: jwtService}
+	opts = append(opts, grpc.ForceServerCodec(jsonCodec{}), grpc.ChainUnaryInterceptor(s.authenticate))
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(usersServiceDesc, s)
+	srv.RegisterService(adminServiceDesc, s)
+	reflectionpb.RegisterServerReflectionServer(srv, reflection.NewServer(reflection.ServerOptions{
+		Services:           srv,
+		DescriptorResolver: schemaFiles,
+	}))
+	return srv
+}
+
+// authenticate puts the principal into the context of calls to methods
+// that need a role, the checks are those of the HTTP middleware.
+func (s *Server) authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	a := methodAccess[info.FullMethod]
+	if a.Role == "" {
+		resp, err := handler(ctx, req)
+		return resp, statusError(err)
+	}
+	var authHeader string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		authHeader = md.Get("authorization")[0]
+	}
+	p, err := s.jwt.AuthenticateHeader(ctx, authHeader, s.users.Repository())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if p.User.Banned(time.Now()) {
+		return nil, status.Error(codes.Unauthenticated, "you are banned! Reason: "+
+			p.User.BanHistory[len(p.User.BanHistory)-1].Reason)
+	}
+	if err := p.Authorize(a.Role, a.Method); err != nil {
+		return nil, statusError(err)
+	}
+	if a.Session {
+		if err := p.AuthorizeSession(); err != nil {
+			return nil, statusError(err)
+		}
+	}
+	resp, err := handler(auth.WithPrincipal(ctx, p), req)
+	return resp, statusError(err)
+}
+
+// statusError gives errors of the service the gRPC code matching the
+// HTTP status the HTTP API answers them with.
+func statusError(err error) error {
+	var fieldErrs domain.FieldErrors
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, auth.ErrUnauthorized), errors.Is(err, service.ErrInvalidCredentials),
+		errors.Is(err, auth.ErrInvalidMFAToken):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, auth.ErrPermissionDenied), errors.Is(err, auth.ErrInsufficientScope),
+		errors.Is(err, auth.ErrMFARequired), errors.Is(err, auth.ErrSessionRequired),
+		errors.Is(err, service.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, auth.ErrMFALocked):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, storage.ErrUserExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrPreconditionFailed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, storage.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "storage timeout")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	case errors.As(err, &fieldErrs):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// withVersion makes the service check the version of the user like
+// If-Match does over HTTP.
+func withVersion(ctx context.Context, version int) context.Context {
+	if version == 0 {
+		return ctx
+	}
+	return service.WithPrecondition(ctx, func(u domain.User) bool {
+		return u.Version == version
+	})
+}
+
+func currentUser(ctx context.Context) domain.User {
+	p, _ := auth.PrincipalFrom(ctx)
+	return p.User
+}
+
+func (s *Server) register(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*RegisterRequest)
+	user, err := s.users.Register(ctx, service.RegisterParams(*r))
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
+
+func (s *Server) login(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*LoginRequest)
+	user, err := s.users.Login(ctx, r.Email, r.Password)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFA.Enabled {
+		token, err := s.jwt.GenerateMFAPendingJWT(user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResponse{MFARequired: true, MFAToken: token}, nil
+	}
+	token, _, err := s.jwt.IssueSession(nil, user, auth.LevelPassword)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResponse{Token: token}, nil
+}
+
+func (s *Server) loginMFA(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*MFALoginRequest)
+	user, err := s.jwt.CompleteMFALogin(r.MFAToken, func(email string) (domain.User, error) {
+		return s.users.VerifySecondFactor(ctx, email, r.Code)
+	})
+	if err != nil {
+		return nil, err
+	}
+	token, _, err := s.jwt.IssueSession(nil, user, auth.LevelMFA)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResponse{Token: token}, nil
+}
+
+func (s *Server) me(ctx context.Context, req interface{}) (interface{}, error) {
+	return newUser(currentUser(ctx)), nil
+}
+
+func (s *Server) updateProfile(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*UpdateProfileRequest)
+	user, err := s.users.UpdateProfile(withVersion(ctx, r.Version), currentUser(ctx).Email,
+		service.ProfileParams{FavoriteCake: r.FavoriteCake})
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
+
+func (s *Server) changePassword(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*ChangePasswordRequest)
+	user, err := s.users.ChangePassword(withVersion(ctx, r.Version), currentUser(ctx).Email, r.Password)
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
+
+func (s *Server) ban(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*BanRequest)
+	var until time.Time
+	if r.DurationDays != 0 {
+		until = time.Now().AddDate(0, 0, r.DurationDays)
+	}
+	user, err := s.users.Ban(withVersion(ctx, r.Version), currentUser(ctx), r.Email, r.Reason, until)
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
+
+func (s *Server) unban(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*UnbanRequest)
+	user, err := s.users.Unban(withVersion(ctx, r.Version), currentUser(ctx), r.Email)
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
+
+func (s *Server) getUser(ctx context.Context, req interface{}) (interface{}, error) {
+	r := req.(*GetUserRequest)
+	email, err := domain.NormalizeEmail(r.Email)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.Repository().Get(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
@@ -0,0 +1,207 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/service"
+	"golang-api/storage"
+)
+
+type nopMailer struct{}
+
+// rawCodec sends the bytes it is given, like a client in another language
+// that writes the JSON messages itself.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) { return v.([]byte), nil }
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "json" }
+
+func (nopMailer) Send(to, subject, body string) error { return nil }
+
+func newTestClient(t *testing.T) (*Client, *service.Users, *auth.JWTService) {
+	dir := t.TempDir()
+	jwtService, err := auth.NewJWTService(filepath.Join(dir, "priv.rsa"), filepath.Join(dir, "pub.rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := service.NewUsers(storage.FromLegacy(storage.NewInMemoryUserStorage()), nopMailer{}, domain.DefaultPasswordPolicy())
+
+	listener := bufconn.Listen(1 << 20)
+	srv := NewServer(users, jwtService)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn), users, jwtService
+}
+
+func assertCode(t *testing.T, expected codes.Code, err error) {
+	t.Helper()
+	if status.Code(err) != expected {
+		t.Errorf("Unexpected status. Expected: %v, actual: %v", expected, err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("register, login and profile", func(t *testing.T) {
+		c, _, _ := newTestClient(t)
+		user, err := c.Register(ctx, &RegisterRequest{Email: "Test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		if err != nil || user.Email != "test@mail.com" {
+			t.Fatal(user, err)
+		}
+		_, err = c.Register(ctx, &RegisterRequest{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		assertCode(t, codes.AlreadyExists, err)
+		_, err = c.Register(ctx, &RegisterRequest{Email: "bad", Password: "somepass", FavoriteCake: "cheesecake"})
+		assertCode(t, codes.InvalidArgument, err)
+
+		_, err = c.Login(ctx, &LoginRequest{Email: "test@mail.com", Password: "wrong"})
+		assertCode(t, codes.Unauthenticated, err)
+		login, err := c.Login(ctx, &LoginRequest{Email: "test@mail.com", Password: "somepass"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Me(ctx)
+		assertCode(t, codes.Unauthenticated, err)
+		authed := WithToken(ctx, login.Token)
+		me, err := c.Me(authed)
+		if err != nil || me.FavoriteCake != "cheesecake" {
+			t.Fatal(me, err)
+		}
+
+		_, err = c.UpdateProfile(authed, &UpdateProfileRequest{FavoriteCake: "napoleon", Version: me.Version + 1})
+		assertCode(t, codes.FailedPrecondition, err)
+		updated, err := c.UpdateProfile(authed, &UpdateProfileRequest{FavoriteCake: "napoleon", Version: me.Version})
+		if err != nil || updated.FavoriteCake != "napoleon" || updated.Version != me.Version+1 {
+			t.Error(updated, err)
+		}
+	})
+
+	t.Run("JSON wire format", func(t *testing.T) {
+		c, _, _ := newTestClient(t)
+		if encoding.GetCodec(codecName) != nil {
+			t.Error("the codec was registered for the whole process")
+		}
+		var resp []byte
+		err := c.conn.Invoke(ctx, "/cake.Users/Register",
+			[]byte(`{"email":"test@mail.com","password":"somepass","favorite_cake":"cheesecake"}`), &resp,
+			grpc.ForceCodec(rawCodec{}))
+		if err != nil || string(resp) != `{"email":"test@mail.com","favorite_cake":"cheesecake","role":"UserRole","banned":false,"version":1}` {
+			t.Error("unexpected response", string(resp), err)
+		}
+	})
+	t.Run("api keys can't change the password", func(t *testing.T) {
+		c, _, jwtService := newTestClient(t)
+		c.Register(ctx, &RegisterRequest{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		key, raw, err := auth.NewAPIKey("test@mail.com", "script", []string{auth.ScopeUserWrite}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwtService.APIKeys().Add(ctx, key)
+		keyCtx := WithToken(ctx, auth.APIKeyAuthScheme+raw)
+
+		if _, err := c.UpdateProfile(keyCtx, &UpdateProfileRequest{FavoriteCake: "napoleon"}); err != nil {
+			t.Error("write key can't update the profile", err)
+		}
+		_, err = c.ChangePassword(keyCtx, &ChangePasswordRequest{Password: "newpassword"})
+		assertCode(t, codes.PermissionDenied, err)
+	})
+	t.Run("moderation", func(t *testing.T) {
+		c, users, jwtService := newTestClient(t)
+		c.Register(ctx, &RegisterRequest{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		userLogin, _ := c.Login(ctx, &LoginRequest{Email: "test@mail.com", Password: "somepass"})
+		users.AddAdmin(ctx, "admin@mail.com", "adminadmin")
+		adminLogin, _ := c.Login(ctx, &LoginRequest{Email: "admin@mail.com", Password: "adminadmin"})
+
+		_, err := c.Ban(WithToken(ctx, userLogin.Token), &BanRequest{Email: "admin@mail.com"})
+		assertCode(t, codes.PermissionDenied, err)
+		_, err = c.Ban(WithToken(ctx, adminLogin.Token), &BanRequest{Email: "test@mail.com"})
+		assertCode(t, codes.PermissionDenied, err) // no 2FA
+
+		admin, _ := users.Repository().Get(ctx, "admin@mail.com")
+		mfaToken, _, err := jwtService.IssueSession(nil, admin, auth.LevelMFA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adminCtx := WithToken(ctx, mfaToken)
+		banned, err := c.Ban(adminCtx, &BanRequest{Email: "test@mail.com", Reason: "making mess", DurationDays: 1})
+		if err != nil || !banned.Banned || banned.BanHistory[0].Until == "" || banned.BanHistory[0].Executor != "admin@mail.com" {
+			t.Fatal(banned, err)
+		}
+		_, err = c.Me(WithToken(ctx, userLogin.Token))
+		assertCode(t, codes.Unauthenticated, err)
+
+		if _, err := c.Unban(adminCtx, &UnbanRequest{Email: "test@mail.com"}); err != nil {
+			t.Fatal(err)
+		}
+		user, err := c.GetUser(adminCtx, &GetUserRequest{Email: "test@mail.com"})
+		if err != nil || user.Banned || len(user.BanHistory) != 2 {
+			t.Error(user, err)
+		}
+	})
+	t.Run("reflection", func(t *testing.T) {
+		c, _, _ := newTestClient(t)
+		stream, err := reflectionpb.NewServerReflectionClient(c.conn.(*grpc.ClientConn)).ServerReflectionInfo(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "cake.Users"},
+		})
+		resp, err := stream.Recv()
+		if err != nil || resp.GetFileDescriptorResponse() == nil {
+			t.Fatal(resp, err)
+		}
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(resp.GetFileDescriptorResponse().FileDescriptorProto[0], file); err != nil {
+			t.Fatal(err)
+		}
+		fd, err := protodesc.NewFile(file, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		me := fd.Services().ByName("Users").Methods().ByName("Me")
+		if me == nil || me.Output().FullName() != "cake.User" {
+			t.Fatal("unexpected Me method", me)
+		}
+		history := me.Output().Fields().ByName("ban_history")
+		if history == nil || !history.IsList() || history.Message().FullName() != "cake.BanEvent" {
+			t.Error("unexpected ban_history field", history)
+		}
+		if fd.Services().ByName("Admin").Methods().ByName("GetUser") == nil {
+			t.Error("GetUser is not described")
+		}
+	})
+}
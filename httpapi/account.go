@@ -0,0 +1,128 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"golang-api/auth"
+)
+
+type DeleteAccountParams struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type accountDeletion struct {
+	DeleteAfter string `json:"delete_after"`
+}
+
+// AccountExport is everything held about a user. Password digests and
+// two-factor secrets are left out, they are credentials rather than data.
+type AccountExport struct {
+	ExportedAt   string           `json:"exported_at"`
+	Profile      ProfileExport    `json:"profile"`
+	BanHistory   []BanEventView   `json:"ban_history"`
+	Sessions     []SessionView    `json:"sessions"`
+	APIKeys      []APIKeyView     `json:"api_keys"`
+	AuditEntries []AuditEntryView `json:"audit_entries"`
+}
+
+type ProfileExport struct {
+	Email          string `json:"email"`
+	FavoriteCake   string `json:"favorite_cake"`
+	Role           string `json:"role"`
+	Banned         bool   `json:"banned"`
+	BanUntil       string `json:"ban_until,omitempty"`
+	MFAEnabled     bool   `json:"mfa_enabled"`
+	ServiceAccount bool   `json:"service_account"`
+	DeleteAfter    string `json:"delete_after,omitempty"`
+	Version        int    `json:"version"`
+}
+
+// AuditEntryView is a moderation action the user took on Target.
+type AuditEntryView struct {
+	Target string `json:"target"`
+	BanEventView
+}
+
+func (uServ UserService) exportHandler(w http.ResponseWriter, r *http.Request, j *auth.JWTService) {
+	p, _ := auth.PrincipalFrom(r.Context())
+	export, err := uServ.users.Export(r.Context(), p.User.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	sessions, err := j.Sessions().List(r.Context(), p.User.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	keys, err := j.APIKeys().List(r.Context(), p.User.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	u := export.User
+	result := AccountExport{
+		ExportedAt: formatTime(time.Now()),
+		Profile: ProfileExport{
+			Email:          u.Email,
+			FavoriteCake:   u.FavoriteCake,
+			Role:           u.EffectiveRole(),
+			Banned:         u.Banned(time.Now()),
+			BanUntil:       formatTime(u.BanUntil),
+			MFAEnabled:     u.MFA.Enabled,
+			ServiceAccount: u.ServiceAccount,
+			DeleteAfter:    formatTime(u.DeleteAfter),
+			Version:        u.Version,
+		},
+		BanHistory:   newUserView(u, true).BanHistory,
+		Sessions:     make([]SessionView, 0, len(sessions)),
+		APIKeys:      make([]APIKeyView, 0, len(keys)),
+		AuditEntries: make([]AuditEntryView, 0, len(export.AuditEntries)),
+	}
+	for _, session := range sessions {
+		result.Sessions = append(result.Sessions, newSessionView(session, p.Session))
+	}
+	for _, key := range keys {
+		result.APIKeys = append(result.APIKeys, newAPIKeyView(key))
+	}
+	for _, entry := range export.AuditEntries {
+		result.AuditEntries = append(result.AuditEntries, AuditEntryView{
+			Target:       entry.Target,
+			BanEventView: newBanEventView(entry.BanHistoryList),
+		})
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="cake-account.json"`)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// deleteAccountHandler schedules the deletion of the account of the
+// current user. The account stays usable until the grace period is over,
+// so that the user can log in and cancel.
+func (uServ UserService) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	params := &DeleteAccountParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	user, err := uServ.users.RequestDeletion(r.Context(), currentUser(r).Email, params.Password)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, accountDeletion{DeleteAfter: formatTime(user.DeleteAfter)})
+}
+
+func (uServ UserService) cancelDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := uServ.users.CancelDeletion(r.Context(), currentUser(r).Email); err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("account deletion canceled"))
+}
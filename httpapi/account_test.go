@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/service"
+)
+
+func TestAccount(t *testing.T) {
+	doRequest := createRequester(t)
+	ctx := context.Background()
+
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().Add(time.Hour)}))
+	defer ts.Close()
+
+	u.users.Register(ctx, service.RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+	user, _ := u.repository.Get(ctx, "test@mail.com")
+	token, _ := j.GenearateJWT(user)
+	request := func(method, path string, params map[string]interface{}) (*http.Request, error) {
+		req, err := newJSONRequest(method, ts.URL+path, prepareParams(t, params))
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req, err
+	}
+
+	t.Run("export", func(t *testing.T) {
+		req, err := request(http.MethodGet, "/v2/user/export", nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.Header.Get("Content-Disposition") != `attachment; filename="cake-account.json"` {
+			t.Error("export is not an attachment", res.Header.Get("Content-Disposition"))
+		}
+		export := AccountExport{}
+		if err := json.NewDecoder(res.Body).Decode(&export); err != nil {
+			t.Fatal(err)
+		}
+		if export.Profile.Email != "test@mail.com" || len(export.Sessions) != 1 || !export.Sessions[0].Current ||
+			export.BanHistory == nil || export.AuditEntries == nil {
+			t.Error("unexpected export", export)
+		}
+	})
+
+	t.Run("delete and cancel", func(t *testing.T) {
+		resp := doRequest(request(http.MethodPost, "/v2/user/delete", map[string]interface{}{"password": "wrong"}))
+		assertStatus(t, 422, resp)
+		assertBody(t, "invalid login params", resp)
+
+		resp = doRequest(request(http.MethodPost, "/v2/user/delete", map[string]interface{}{"password": "somepass"}))
+		assertStatus(t, 202, resp)
+		deletion := accountDeletion{}
+		json.Unmarshal(resp.body, &deletion)
+		deleteAfter, err := time.Parse(time.RFC3339, deletion.DeleteAfter)
+		if err != nil || time.Until(deleteAfter) < service.DefaultDeletionGrace-time.Minute {
+			t.Error("unexpected deletion time", string(resp.body))
+		}
+
+		resp = doRequest(request(http.MethodPost, "/v2/user/delete/cancel", nil))
+		assertStatus(t, 200, resp)
+		if user, _ := u.repository.Get(ctx, "test@mail.com"); !user.DeleteAfter.IsZero() {
+			t.Error("deletion was not canceled")
+		}
+	})
+
+	t.Run("purged users lose their sessions", func(t *testing.T) {
+		doRequest(request(http.MethodPost, "/v2/user/delete", map[string]interface{}{"password": "somepass"}))
+		purged, err := u.users.PurgeDeletedAndRevoke(ctx, time.Now().Add(service.DefaultDeletionGrace+time.Minute), j)
+		if err != nil || len(purged) != 1 {
+			t.Fatal(purged, err)
+		}
+		u.users.Register(ctx, service.RegisterParams{Email: "test@mail.com", Password: "otherpass", FavoriteCake: "napoleon"})
+
+		// the old token would log in to the new account otherwise
+		resp := doRequest(request(http.MethodGet, "/v2/user/me", nil))
+		assertStatus(t, 422, resp)
+	})
+}
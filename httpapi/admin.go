@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/domain"
+)
+
+type UserBanParams struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason,omitempty"`
+	// DurationDays is the length of the ban, 0 bans the user until unbanned.
+	DurationDays int `json:"duration_days,omitempty"`
+}
+type EmailParams struct {
+	Email string `json:"email" validate:"required,email"`
+}
+type UserUnbanParams = EmailParams
+
+func (uServ UserService) banUserHandler(w http.ResponseWriter, r *http.Request) {
+	params := &UserBanParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	var until time.Time
+	if params.DurationDays != 0 {
+		until = time.Now().AddDate(0, 0, params.DurationDays)
+	}
+	user, err := uServ.users.Ban(withIfMatch(r), currentUser(r), params.Email, params.Reason, until)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	setETag(w, user)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("user " + user.Email + " banned"))
+}
+
+func (uServ UserService) unbanUserHandler(w http.ResponseWriter, r *http.Request) {
+	params := &UserUnbanParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	user, err := uServ.users.Unban(withIfMatch(r), currentUser(r), params.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	setETag(w, user)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("user " + user.Email + " unbanned"))
+}
+
+// deleteUserHandler soft deletes a user and ends every session of it, a
+// restored user logs in again. API keys are kept, they don't work while
+// the owner is deleted and work again once it is restored. Purges revoke
+// them.
+func (uServ UserService) deleteUserHandler(w http.ResponseWriter, r *http.Request, j *auth.JWTService) {
+	params := &EmailParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	user, err := uServ.users.DeleteUser(withIfMatch(r), currentUser(r), params.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	if _, err := j.Sessions().DeleteAll(r.Context(), user.Email); err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("user " + user.Email + " deleted"))
+}
+
+func (uServ UserService) restoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	params := &EmailParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	user, err := uServ.users.RestoreUser(r.Context(), currentUser(r), params.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	setETag(w, user)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("user " + user.Email + " restored"))
+}
+
+// purgeUserHandler purges a deleted user and revokes its API keys, so they
+// don't work for a new account with the same email.
+func (uServ UserService) purgeUserHandler(w http.ResponseWriter, r *http.Request, j *auth.JWTService) {
+	params := &EmailParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	user, err := uServ.users.PurgeUser(r.Context(), currentUser(r), params.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := j.RevokeUser(r.Context(), user.Email); err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("user " + user.Email + " purged"))
+}
+
+func (uServ UserService) inspectHandler(w http.ResponseWriter, r *http.Request) {
+	email, err := domain.NormalizeEmail(r.URL.Query().Get("email"))
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	user, getErr := uServ.repository.Get(r.Context(), email)
+	if getErr != nil {
+		handleError(getErr, w)
+		return
+	}
+	setETag(w, user)
+	switch negotiate(r, contentTypeText, contentTypeJSON) {
+	case contentTypeJSON:
+		writeJSON(w, http.StatusOK, newUserView(user, true))
+		return
+	case "":
+		handleErrorCode(errNotAcceptable, http.StatusNotAcceptable, w)
+		return
+	}
+
+	HistoryStr := ""
+
+	for _, query := range user.BanHistory {
+		banStr := ""
+		if query.IsBan {
+			banStr = "banned (reason: " + query.Reason + ")"
+			if !query.Until.IsZero() {
+				banStr += " until " + query.Until.UTC().Format(time.RFC3339)
+			}
+		} else {
+			banStr = "unbanned"
+		}
+		HistoryStr += "-- was " + banStr + " at " +
+			query.Time.UTC().Format(time.RFC3339) +
+			" by " + query.Executor + "\n"
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("user " + user.Email + ":\n" + HistoryStr))
+}
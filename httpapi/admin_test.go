@@ -0,0 +1,538 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/service"
+)
+
+func TestAdmin_JWT(t *testing.T) {
+	doRequest := createRequester(t)
+	os.Setenv("CAKE_ADMIN_EMAIL", "admin@mail.com")
+	os.Setenv("CAKE_ADMIN_PASSWORD", "adminadmin")
+
+	t.Run("deny acess be wrong login", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+
+		ts3 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.banUserHandler))
+		defer ts.Close()
+
+		registerParams := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+
+		banParams := map[string]interface{}{
+			"email":  "test@gmail.com",
+			"reason": "testtest",
+		}
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, registerParams)))
+
+		req, _ := newJSONRequest(http.MethodPost, ts3.URL+"/admin/ban", prepareParams(t, banParams))
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		resp := doRequest(req, nil)
+		assertStatus(t, 422, resp)
+		assertBody(t, "invalid login params", resp)
+	})
+
+	t.Run("banning user", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		ts3 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.banUserHandler))
+		defer ts.Close()
+		registerParams := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepassss",
+			"favorite_cake": "cheesecake",
+		}
+		banParams := map[string]interface{}{
+			"email":  "test@mail.com",
+			"reason": "making mess",
+		}
+
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, registerParams)))
+
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		req, _ := newJSONRequest(http.MethodPost, ts3.URL+"/admin/ban", prepareParams(t, banParams))
+		req.Header.Set("Authorization", "Bearer "+string(adminJwt))
+		resp := doRequest(req, nil)
+
+		assertStatus(t, 200, resp)
+		assertBody(t, "user test@mail.com banned", resp)
+
+	})
+
+	t.Run("unbanning user", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		ts2 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.banUserHandler))
+		ts3 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.unbanUserHandler))
+		defer ts.Close()
+
+		registerParams := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		unbanParams := map[string]interface{}{
+			"email": "test@mail.com",
+		}
+		banParams := map[string]interface{}{
+			"email":  "test@mail.com",
+			"reason": "making mess",
+		}
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, registerParams)))
+
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		banReq, _ := newJSONRequest(http.MethodPost, ts2.URL+"/admin/ban", prepareParams(t, banParams))
+		banReq.Header.Set("Authorization", "Bearer "+string(adminJwt))
+		doRequest(banReq, nil)
+
+		unbanReq, _ := newJSONRequest(http.MethodPost, ts3.URL+"/admin/unban", prepareParams(t, unbanParams))
+		unbanReq.Header.Set("Authorization", "Bearer "+string(adminJwt))
+		unbunned := doRequest(unbanReq, nil)
+
+		assertStatus(t, 200, unbunned)
+		assertBody(t, "user test@mail.com unbanned", unbunned)
+	})
+
+	t.Run("inspecting user with ban history", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		ts2 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.banUserHandler))
+		ts3 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.unbanUserHandler))
+		ts4 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.inspectHandler))
+
+		defer ts.Close()
+
+		registerParams := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		jwtParams := map[string]interface{}{
+			"email":    os.Getenv("CAKE_SUPERADMIN_EMAIL"),
+			"password": os.Getenv("CAKE_SUPERADMIN_PASSWORD"),
+		}
+		banParams := map[string]interface{}{
+			"email":  "test@mail.com",
+			"reason": "making mess",
+		}
+
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, registerParams)))
+
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		banReq, _ := newJSONRequest(http.MethodPost, ts2.URL+"/admin/ban", prepareParams(t, banParams))
+		banReq.Header.Set("Authorization", "Bearer "+string(adminJwt))
+		doRequest(banReq, nil)
+
+		unbanParams := map[string]interface{}{
+			"email": "test@mail.com",
+		}
+		unbanReq, _ := newJSONRequest(http.MethodPost, ts3.URL+"/admin/unban", prepareParams(t, unbanParams))
+		unbanReq.Header.Set("Authorization", "Bearer "+string(adminJwt))
+		doRequest(unbanReq, nil)
+
+		stored, _ := u.repository.Get(context.Background(), "test@mail.com")
+		banTime := stored.BanHistory[0].Time.UTC().Format(time.RFC3339)
+		unbanTime := stored.BanHistory[1].Time.UTC().Format(time.RFC3339)
+		if _, err := time.Parse(time.RFC3339, banTime); err != nil {
+			t.Fatal(err)
+		}
+		banStr := "-- was banned (reason: making mess) at " + banTime + " by " +
+			os.Getenv("CAKE_ADMIN_EMAIL") + "\n"
+		unbanStr := "-- was unbanned at " + unbanTime + " by " +
+			os.Getenv("CAKE_ADMIN_EMAIL") + "\n"
+
+		inspectReq, _ := http.NewRequest(http.MethodGet,
+			ts4.URL+"/admin/inspect?email=test@mail.com",
+			prepareParams(t, jwtParams))
+		inspectReq.Header.Set("Authorization", "Bearer "+string(adminJwt))
+		inspectRest := doRequest(inspectReq, nil)
+
+		assertStatus(t, 200, inspectRest)
+		assertBody(t, "user test@mail.com:\n"+(banStr)+unbanStr, inspectRest)
+	})
+
+	t.Run("banned user accessing api with jwt", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		ts2 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.banUserHandler))
+		ts3 := httptest.NewServer(jwtAuth(jwtService, u.repository, getCakeHandler))
+
+		defer ts.Close()
+		registerParams := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		banParams := map[string]interface{}{
+			"email":  "test@mail.com",
+			"reason": "making mess",
+		}
+
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, registerParams)))
+
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		Useruser, _ := u.repository.Get(context.Background(), "test@mail.com")
+		userJwt, _ := jwtService.GenearateJWT(Useruser)
+
+		req, _ := newJSONRequest(http.MethodPost, ts2.URL+"/admin/ban", prepareParams(t, banParams))
+		req.Header.Set("Authorization", "Bearer "+string(adminJwt))
+		resp := doRequest(req, nil)
+
+		assertStatus(t, 200, resp)
+		assertBody(t, "user test@mail.com banned", resp)
+
+		req, err := http.NewRequest(http.MethodGet, ts3.URL, nil)
+		req.Header.Add("Authorization", "Bearer "+string(userJwt))
+		bannedResp := doRequest(req, err)
+		assertStatus(t, 401, bannedResp)
+		assertBody(t, "you are banned! Reason: making mess", bannedResp)
+	})
+
+	t.Run("banning user with wrong email without @", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		ts2 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.banUserHandler))
+		defer ts.Close()
+
+		// registration
+		registerParams := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, registerParams)))
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		banParams := map[string]interface{}{
+			"email":  "notAnEmail",
+			"reason": "making mess",
+		}
+		req, _ := newJSONRequest(http.MethodPost, ts2.URL+"/admin/ban", prepareParams(t, banParams))
+		req.Header.Set("Authorization", "Bearer "+string(adminJwt))
+		resp := doRequest(req, nil)
+
+		assertStatus(t, 422, resp)
+		assertBody(t, "mail: missing '@' or angle-addr", resp)
+	})
+
+	t.Run("banning user with stale etag", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		ts2 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.banUserHandler))
+		ts3 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.unbanUserHandler))
+		ts4 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.inspectHandler))
+		defer ts.Close()
+		defer ts2.Close()
+		defer ts3.Close()
+		defer ts4.Close()
+
+		registerParams := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		doRequest(newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, registerParams)))
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		inspectReq, _ := http.NewRequest(http.MethodGet, ts4.URL+"?email=test@mail.com", nil)
+		inspectReq.Header.Set("Authorization", "Bearer "+adminJwt)
+		inspectRes, err := http.DefaultClient.Do(inspectReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inspectRes.Body.Close()
+		etag := inspectRes.Header.Get("ETag")
+		if etag == "" {
+			t.Fatal("inspect response has no ETag")
+		}
+
+		banParams := map[string]interface{}{
+			"email":  "test@mail.com",
+			"reason": "making mess",
+		}
+		banReq, _ := newJSONRequest(http.MethodPost, ts2.URL, prepareParams(t, banParams))
+		banReq.Header.Set("Authorization", "Bearer "+adminJwt)
+		banReq.Header.Set("If-Match", etag)
+		assertStatus(t, 200, doRequest(banReq, nil))
+
+		unbanParams := map[string]interface{}{
+			"email": "test@mail.com",
+		}
+		unbanReq, _ := newJSONRequest(http.MethodPost, ts3.URL, prepareParams(t, unbanParams))
+		unbanReq.Header.Set("Authorization", "Bearer "+adminJwt)
+		unbanReq.Header.Set("If-Match", etag)
+		resp := doRequest(unbanReq, nil)
+		assertStatus(t, 412, resp)
+
+		user, _ := u.repository.Get(context.Background(), "test@mail.com")
+		if !user.Ban {
+			t.Error("stale unban overwrote the ban")
+		}
+	})
+	t.Run("listing users", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+		ts := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.listUsersHandler))
+		defer ts.Close()
+
+		for _, email := range []string{"b@mail.com", "a@mail.com", "c@mail.com"} {
+			u.repository.Add(context.Background(), email, domain.User{Email: email, FavoriteCake: "cheesecake"})
+		}
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"?role=UserRole&limit=2", nil)
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		resp := doRequest(req, nil)
+		assertStatus(t, 200, resp)
+
+		list := userListResponse{}
+		if err := json.Unmarshal(resp.body, &list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Users) != 2 || list.Users[0].Email != "a@mail.com" || list.NextCursor == "" {
+			t.Fatal("unexpected first page", getBody(resp))
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, ts.URL+"?role=UserRole&limit=2&cursor="+list.NextCursor, nil)
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		resp = doRequest(req, nil)
+		list = userListResponse{}
+		json.Unmarshal(resp.body, &list)
+		if len(list.Users) != 1 || list.Users[0].Email != "c@mail.com" || list.NextCursor != "" {
+			t.Error("unexpected last page", getBody(resp))
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, ts.URL+"?banned=maybe", nil)
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		resp = doRequest(req, nil)
+		assertStatus(t, 422, resp)
+	})
+	t.Run("inspecting user as json", func(t *testing.T) {
+		u := newTestUserService()
+
+		jwtService, jwtErr := auth.NewJWTService(testKeyPaths(t))
+		if jwtErr != nil {
+			panic(jwtErr)
+		}
+		ts := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.banUserHandler))
+		ts2 := httptest.NewServer(jwtAuthAdmin(jwtService, u.repository, u.inspectHandler))
+		defer ts.Close()
+		defer ts2.Close()
+
+		u.repository.Add(context.Background(), "test@mail.com", domain.User{Email: "test@mail.com", FavoriteCake: "cheesecake"})
+		u.AddAdmin(context.Background())
+		Adminuser, _ := u.repository.Get(context.Background(), os.Getenv("CAKE_ADMIN_EMAIL"))
+		adminJwt, _ := jwtService.GenerateMFAJWT(Adminuser)
+
+		banParams := map[string]interface{}{
+			"email":  "test@mail.com",
+			"reason": "making mess",
+		}
+		banReq, _ := newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, banParams))
+		banReq.Header.Set("Authorization", "Bearer "+adminJwt)
+		doRequest(banReq, nil)
+
+		req, _ := http.NewRequest(http.MethodGet, ts2.URL+"?email=test@mail.com", nil)
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		req.Header.Set("Accept", "application/json")
+		resp := doRequest(req, nil)
+		assertStatus(t, 200, resp)
+
+		view := UserView{}
+		if err := json.Unmarshal(resp.body, &view); err != nil {
+			t.Fatal(err)
+		}
+		if view.Email != "test@mail.com" || !view.Banned || len(view.BanHistory) != 1 {
+			t.Fatal("unexpected user view", getBody(resp))
+		}
+		banTime, err := time.Parse(time.RFC3339, view.BanHistory[0].Time)
+		if err != nil || time.Since(banTime) > time.Minute {
+			t.Error("unexpected ban time", view.BanHistory[0].Time)
+		}
+		if view.BanHistory[0].Reason != "making mess" || !view.BanHistory[0].Banned {
+			t.Error("unexpected ban event", view.BanHistory[0])
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, ts2.URL+"?email=test@mail.com", nil)
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		req.Header.Set("Accept", "text/plain")
+		resp = doRequest(req, nil)
+		assertStatus(t, 200, resp)
+		assertBody(t, "user test@mail.com:\n-- was banned (reason: making mess) at "+view.BanHistory[0].Time+" by admin@mail.com\n", resp)
+
+		// the most specific range decides, q=0 excludes text/plain
+		req, _ = http.NewRequest(http.MethodGet, ts2.URL+"?email=test@mail.com", nil)
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		req.Header.Set("Accept", "text/plain;q=0, */*")
+		resp = doRequest(req, nil)
+		assertStatus(t, 200, resp)
+		if err := json.Unmarshal(resp.body, &UserView{}); err != nil {
+			t.Error("excluded text/plain was served", getBody(resp))
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, ts2.URL+"?email=test@mail.com", nil)
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		req.Header.Set("Accept", "image/png")
+		resp = doRequest(req, nil)
+		assertStatus(t, 406, resp)
+	})
+}
+
+func TestAdminDeletion(t *testing.T) {
+	doRequest := createRequester(t)
+	ctx := context.Background()
+
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().Add(time.Hour)}))
+	defer ts.Close()
+
+	u.users.AddAdmin(ctx, "admin@mail.com", "adminadmin")
+	admin, _ := u.repository.Get(ctx, "admin@mail.com")
+	adminToken, _ := j.GenerateMFAJWT(admin)
+	u.users.Register(ctx, service.RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+	user, _ := u.repository.Get(ctx, "test@mail.com")
+	userToken, _ := j.GenearateJWT(user)
+	request := func(token, method, path string, params map[string]interface{}) parsedResponse {
+		req, err := newJSONRequest(method, ts.URL+path, prepareParams(t, params))
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return doRequest(req, err)
+	}
+	target := map[string]interface{}{"email": "test@mail.com"}
+	key, raw, _ := auth.NewAPIKey("test@mail.com", "ci", []string{auth.ScopeUserRead}, 0)
+	j.APIKeys().Add(ctx, key)
+	requestWithKey := func() parsedResponse {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v2/user/me", nil)
+		if err == nil {
+			req.Header.Set("Authorization", auth.APIKeyAuthScheme+raw)
+		}
+		return doRequest(req, err)
+	}
+
+	resp := request(adminToken, http.MethodPost, "/v2/admin/delete", target)
+	assertStatus(t, 200, resp)
+	assertBody(t, "user test@mail.com deleted", resp)
+
+	resp = request(userToken, http.MethodGet, "/v2/user/me", nil)
+	assertStatus(t, 422, resp)
+	resp = requestWithKey()
+	assertStatus(t, 422, resp)
+	resp = doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v2/user/register", prepareParams(t, map[string]interface{}{
+		"email": "test@mail.com", "password": "otherpass", "favorite_cake": "napoleon",
+	})))
+	assertStatus(t, 422, resp)
+	assertBody(t, "user with same login already exists", resp)
+
+	resp = request(adminToken, http.MethodGet, "/v2/admin/users?deleted=true", nil)
+	assertStatus(t, 200, resp)
+	list := userListResponse{}
+	json.Unmarshal(resp.body, &list)
+	if len(list.Users) != 1 || list.Users[0].DeletedBy != "admin@mail.com" || list.Users[0].DeletedAt == "" {
+		t.Error("unexpected deleted users", string(resp.body))
+	}
+
+	resp = request(adminToken, http.MethodPost, "/v2/admin/restore", target)
+	assertStatus(t, 200, resp)
+	assertBody(t, "user test@mail.com restored", resp)
+	// deleting ended the sessions, restored users log in again
+	resp = request(userToken, http.MethodGet, "/v2/user/me", nil)
+	assertStatus(t, 422, resp)
+	// API keys only stop working while the user is deleted
+	resp = requestWithKey()
+	assertStatus(t, 200, resp)
+
+	resp = request(adminToken, http.MethodPost, "/v2/admin/purge", target)
+	assertStatus(t, 422, resp)
+	assertBody(t, "user is not deleted", resp)
+	request(adminToken, http.MethodPost, "/v2/admin/delete", target)
+	resp = request(adminToken, http.MethodPost, "/v2/admin/purge", target)
+	assertStatus(t, 200, resp)
+	assertBody(t, "user test@mail.com purged", resp)
+	if _, err := u.repository.GetDeleted(ctx, "test@mail.com"); err == nil {
+		t.Error("tombstone was not purged")
+	}
+	if key, _ := j.APIKeys().Get(ctx, key.ID); !key.Revoked {
+		t.Error("purge did not revoke the api key")
+	}
+}
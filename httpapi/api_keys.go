@@ -0,0 +1,233 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"golang-api/auth"
+	"golang-api/domain"
+)
+
+type APIKeyParams struct {
+	Name   string   `json:"name" validate:"required,max=64"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays is the lifetime of the key, 0 means it never expires.
+	ExpiresInDays int `json:"expires_in_days,omitempty"`
+}
+
+type AdminAPIKeyParams struct {
+	Owner         string   `json:"owner" validate:"required,email"`
+	Name          string   `json:"name" validate:"required,max=64"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+type ServiceAccountParams struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"oneof=UserRole AdminRole"`
+}
+
+// validateAPIKeyParams checks what struct tags can't: the scopes and the
+// lifetime. allowed are the scopes the caller may grant.
+func validateAPIKeyParams(r *http.Request, params interface{}, scopes []string, days int, allowed ...string) error {
+	errs := domain.Validate(params)
+	if len(scopes) == 0 {
+		errs = append(errs, domain.NewFieldError("scopes", "required", ""))
+	}
+	for _, scope := range scopes {
+		if !contains(allowed, scope) {
+			errs = append(errs, domain.NewFieldError("scopes", "oneof", strings.Join(allowed, " ")))
+			break
+		}
+	}
+	if days < 0 || days > auth.MaxAPIKeyLifetime {
+		errs = append(errs, domain.NewFieldError("expires_in_days", "range", fmt.Sprintf("0-%d", auth.MaxAPIKeyLifetime)))
+	}
+	if len(errs) > 0 {
+		return localize(r, errs)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type APIKeyView struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Owner     string   `json:"owner"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt string   `json:"created_at"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
+	LastUsed  string   `json:"last_used_at,omitempty"`
+	Revoked   bool     `json:"revoked"`
+	// Key is the raw key, it is only in the response that creates it.
+	Key string `json:"key,omitempty"`
+}
+
+func newAPIKeyView(k auth.APIKey) APIKeyView {
+	return APIKeyView{
+		ID:        k.ID,
+		Name:      k.Name,
+		Owner:     k.Owner,
+		Scopes:    k.Scopes,
+		CreatedAt: formatTime(k.Created),
+		ExpiresAt: formatTime(k.Expires),
+		LastUsed:  formatTime(k.LastUsed),
+		Revoked:   k.Revoked,
+	}
+}
+
+func (j authHandlers) storeAPIKey(w http.ResponseWriter, r *http.Request, owner, name string, scopes []string, days int) {
+	key, raw, err := auth.NewAPIKey(owner, name, scopes, days)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := j.APIKeys().Add(r.Context(), key); err != nil {
+		handleError(err, w)
+		return
+	}
+	view := newAPIKeyView(key)
+	view.Key = raw
+	writeJSON(w, http.StatusCreated, view)
+}
+
+func (j authHandlers) listAPIKeys(w http.ResponseWriter, r *http.Request, owner string) {
+	keys, err := j.APIKeys().List(r.Context(), owner)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	views := make([]APIKeyView, 0, len(keys))
+	for _, key := range keys {
+		views = append(views, newAPIKeyView(key))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// createAPIKeyHandler creates a key of the current user. Admin keys are
+// only made through the admin route, which needs a 2FA session.
+func (j authHandlers) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	params := &APIKeyParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	err := validateAPIKeyParams(r, params, params.Scopes, params.ExpiresInDays, auth.ScopeUserRead, auth.ScopeUserWrite)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	j.storeAPIKey(w, r, u.Email, params.Name, params.Scopes, params.ExpiresInDays)
+}
+
+func (j authHandlers) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	j.listAPIKeys(w, r, currentUser(r).Email)
+}
+
+func (j authHandlers) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	key, err := j.APIKeys().Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil || key.Owner != u.Email {
+		handleErrorCode(auth.ErrAPIKeyNotFound, http.StatusNotFound, w)
+		return
+	}
+	if err := j.APIKeys().Revoke(r.Context(), key.ID); err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("api key revoked"))
+}
+
+func (j authHandlers) adminCreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	params := &AdminAPIKeyParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	err := validateAPIKeyParams(r, params, params.Scopes, params.ExpiresInDays, auth.ScopeUserRead, auth.ScopeUserWrite, auth.ScopeAdmin)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	owner, err := domain.NormalizeEmail(params.Owner)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	user, err := j.users.Get(r.Context(), owner)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	if contains(params.Scopes, auth.ScopeAdmin) && user.Role != "AdminRole" {
+		handleError(errors.New("admin scope needs an owner with the AdminRole"), w)
+		return
+	}
+	j.storeAPIKey(w, r, user.Email, params.Name, params.Scopes, params.ExpiresInDays)
+}
+
+func (j authHandlers) adminListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.URL.Query().Get("owner")
+	if owner != "" {
+		var err error
+		if owner, err = domain.NormalizeEmail(owner); err != nil {
+			handleError(err, w)
+			return
+		}
+	}
+	j.listAPIKeys(w, r, owner)
+}
+
+func (j authHandlers) adminRevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := j.APIKeys().Revoke(r.Context(), mux.Vars(r)["id"]); err != nil {
+		handleErrorCode(err, http.StatusNotFound, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("api key revoked"))
+}
+
+// createServiceAccountHandler adds a user for automation. Service accounts
+// have no password, they work only with API keys.
+func (uServ UserService) createServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	params := &ServiceAccountParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	email, err := domain.NormalizeEmail(params.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	account := domain.User{
+		Email:          email,
+		Role:           params.Role,
+		BanHistory:     domain.History{},
+		ServiceAccount: true,
+	}
+	if err := uServ.repository.Add(r.Context(), email, account); err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("service account created"))
+}
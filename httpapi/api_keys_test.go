@@ -0,0 +1,203 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+)
+
+func TestAPIKeys(t *testing.T) {
+	doRequest := createRequester(t)
+	os.Setenv("CAKE_ADMIN_EMAIL", "admin@mail.com")
+	os.Setenv("CAKE_ADMIN_PASSWORD", "adminadmin")
+
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.FailNow()
+	}
+	ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().AddDate(1, 0, 0)}))
+	defer ts.Close()
+
+	doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v2/user/register", prepareParams(t, map[string]interface{}{
+		"email":         "test@mail.com",
+		"password":      "somepass",
+		"favorite_cake": "cheesecake",
+	})))
+	user, _ := u.repository.Get(context.Background(), "test@mail.com")
+	userJwt, _ := j.GenearateJWT(user)
+	u.AddAdmin(context.Background())
+	admin, _ := u.repository.Get(context.Background(), "admin@mail.com")
+	adminJwt, _ := j.GenerateMFAJWT(admin)
+
+	call := func(method, path, authorization string, params map[string]interface{}) parsedResponse {
+		var req *http.Request
+		var err error
+		if params != nil {
+			req, err = newJSONRequest(method, ts.URL+path, prepareParams(t, params))
+		} else {
+			req, err = http.NewRequest(method, ts.URL+path, nil)
+		}
+		if err == nil {
+			req.Header.Set("Authorization", authorization)
+		}
+		return doRequest(req, err)
+	}
+	createKey := func(path, authorization string, params map[string]interface{}) APIKeyView {
+		resp := call(http.MethodPost, path, authorization, params)
+		assertStatus(t, 201, resp)
+		var view APIKeyView
+		if err := json.Unmarshal(resp.body, &view); err != nil || !strings.HasPrefix(view.Key, auth.APIKeyPrefix) {
+			t.Fatal("unexpected key", getBody(resp))
+		}
+		return view
+	}
+
+	t.Run("scoped personal key", func(t *testing.T) {
+		key := createKey("/v2/user/api-keys", "Bearer "+userJwt, map[string]interface{}{
+			"name":   "backup script",
+			"scopes": []string{auth.ScopeUserRead},
+		})
+		stored, _ := j.APIKeys().Get(context.Background(), key.ID)
+		if strings.Contains(key.Key, stored.Hash) || !stored.LastUsed.IsZero() {
+			t.Error("unexpected stored key", stored)
+		}
+
+		resp := call(http.MethodGet, "/v2/user/me", "ApiKey "+key.Key, nil)
+		assertStatus(t, 200, resp)
+		if stored, _ := j.APIKeys().Get(context.Background(), key.ID); stored.LastUsed.IsZero() {
+			t.Error("last use was not tracked")
+		}
+
+		resp = call(http.MethodPost, "/v2/user/favorite_cake", "ApiKey "+key.Key, map[string]interface{}{
+			"favorite_cake": "muffin",
+		})
+		assertStatus(t, 422, resp)
+		assertBody(t, "api key scope does not allow this request", resp)
+
+		resp = call(http.MethodGet, "/v2/user/api-keys", "Bearer "+userJwt, nil)
+		if strings.Contains(getBody(resp), key.Key) || !strings.Contains(getBody(resp), key.ID) {
+			t.Error("unexpected key list", getBody(resp))
+		}
+
+		resp = call(http.MethodDelete, "/v2/user/api-keys/"+key.ID, "Bearer "+userJwt, nil)
+		assertStatus(t, 200, resp)
+		resp = call(http.MethodGet, "/v2/user/me", "ApiKey "+key.Key, nil)
+		assertBody(t, "unauthorized", resp)
+	})
+	t.Run("keys can't manage credentials or the account", func(t *testing.T) {
+		key := createKey("/v2/user/api-keys", "Bearer "+userJwt, map[string]interface{}{
+			"name":   "leaked",
+			"scopes": []string{auth.ScopeUserRead, auth.ScopeUserWrite},
+		})
+		resp := call(http.MethodPost, "/v2/user/favorite_cake", "ApiKey "+key.Key, map[string]interface{}{
+			"favorite_cake": "muffin",
+		})
+		assertStatus(t, 200, resp)
+
+		cases := []struct {
+			method, path string
+			params       map[string]interface{}
+		}{
+			{http.MethodPost, "/v2/user/password", map[string]interface{}{"password": "newpassword"}},
+			{http.MethodPost, "/v2/user/email", map[string]interface{}{"email": "thief@mail.com"}},
+			{http.MethodPost, "/v2/user/api-keys", map[string]interface{}{"name": "forever", "scopes": []string{auth.ScopeUserWrite}}},
+			{http.MethodDelete, "/v2/user/api-keys/" + key.ID, nil},
+			{http.MethodPost, "/v2/user/mfa/enroll", nil},
+			{http.MethodPost, "/v2/user/mfa/disable", map[string]interface{}{"code": "123456"}},
+			{http.MethodPost, "/v2/user/delete", map[string]interface{}{"password": "somepass"}},
+		}
+		for _, c := range cases {
+			resp := call(c.method, c.path, "ApiKey "+key.Key, c.params)
+			if resp.status != 422 || getBody(resp) != auth.ErrSessionRequired.Error() {
+				t.Errorf("%s %s: unexpected answer %d %s", c.method, c.path, resp.status, getBody(resp))
+			}
+		}
+		if stored, _ := u.repository.Get(context.Background(), "test@mail.com"); !stored.DeleteAfter.IsZero() {
+			t.Error("the key deleted the account")
+		}
+	})
+	t.Run("invalid keys", func(t *testing.T) {
+		resp := call(http.MethodPost, "/v2/user/api-keys", "Bearer "+userJwt, map[string]interface{}{
+			"name":            "too much",
+			"scopes":          []string{auth.ScopeAdmin},
+			"expires_in_days": 1000,
+		})
+		assertStatus(t, 422, resp)
+		assertBody(t, "The scopes field should be one of: user:read user:write\n"+
+			"The expires_in_days field should be in the range 0-365", resp)
+
+		key := createKey("/v2/user/api-keys", "Bearer "+userJwt, map[string]interface{}{
+			"name":   "guessing",
+			"scopes": []string{auth.ScopeUserRead},
+		})
+		forged := strings.TrimPrefix(key.Key, auth.APIKeyPrefix+key.ID+".")
+		forged = auth.APIKeyPrefix + key.ID + "." + strings.Repeat("0", len(forged))
+		resp = call(http.MethodGet, "/v2/user/me", "ApiKey "+forged, nil)
+		assertBody(t, "unauthorized", resp)
+	})
+	t.Run("service account key", func(t *testing.T) {
+		resp := call(http.MethodPost, "/v2/admin/service-accounts", "Bearer "+adminJwt, map[string]interface{}{
+			"email": "moderator-bot@mail.com",
+			"role":  "AdminRole",
+		})
+		assertStatus(t, 201, resp)
+		key := createKey("/v2/admin/api-keys", "Bearer "+adminJwt, map[string]interface{}{
+			"owner":           "moderator-bot@mail.com",
+			"name":            "moderation",
+			"scopes":          []string{auth.ScopeAdmin},
+			"expires_in_days": 30,
+		})
+		if key.ExpiresAt == "" {
+			t.Error("key should expire")
+		}
+
+		resp = call(http.MethodGet, "/v2/admin/users?limit=1", "ApiKey "+key.Key, nil)
+		assertStatus(t, 200, resp)
+
+		resp = doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v2/user/jwt", prepareParams(t, map[string]interface{}{
+			"email":    "moderator-bot@mail.com",
+			"password": "",
+		})))
+		assertBody(t, "invalid login params", resp)
+
+		resp = call(http.MethodDelete, "/v2/admin/api-keys/"+key.ID, "Bearer "+adminJwt, nil)
+		assertStatus(t, 200, resp)
+		resp = call(http.MethodGet, "/v2/admin/users", "ApiKey "+key.Key, nil)
+		assertBody(t, "unauthorized", resp)
+	})
+	t.Run("raw key is not logged", func(t *testing.T) {
+		var logs bytes.Buffer
+		log.SetOutput(&logs)
+		defer log.SetOutput(os.Stderr)
+
+		// served in place, so the request is logged once ServeHTTP returns
+		router := NewRouter(u, j, RouterConfig{LegacySunset: time.Now().AddDate(1, 0, 0)})
+		req, _ := newJSONRequest(http.MethodPost, "/v2/user/api-keys", prepareParams(t, map[string]interface{}{
+			"name": "logged key", "scopes": []string{auth.ScopeUserRead},
+		}))
+		req.Header.Set("Authorization", "Bearer "+userJwt)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		var view APIKeyView
+		if err := json.Unmarshal(rec.Body.Bytes(), &view); err != nil || view.Key == "" {
+			t.Fatal("unexpected key", rec.Body.String())
+		}
+		if !strings.Contains(logs.String(), "/v2/user/api-keys -> 201") {
+			t.Error("request was not logged", logs.String())
+		}
+		if strings.Contains(logs.String(), view.Key) {
+			t.Error("raw key is in the log", logs.String())
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"golang-api/auth"
+	"golang-api/storage"
+)
+
+// authHandlers serve the sessions and API keys of users. The stores are
+// in the JWTService, users is needed to check the owners.
+type authHandlers struct {
+	*auth.JWTService
+	users storage.UserRepository
+}
+
+var errCSRF = &requestError{http.StatusForbidden, errors.New("missing or invalid CSRF token")}
+
+type csrfResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+// writeSession answers a successful login. In cookie mode the token goes
+// to an HttpOnly cookie and the body has the CSRF token instead.
+func writeSession(w http.ResponseWriter, j *auth.JWTService, token string, session auth.Session, cookie bool) {
+	if !cookie {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(token))
+		return
+	}
+	expires := session.Created.Add(auth.SessionTTL)
+	csrf := j.CSRFToken(session.ID)
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CSRFCookieName,
+		Value:    csrf,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	writeJSON(w, http.StatusOK, csrfResponse{CSRFToken: csrf})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{auth.SessionCookieName, auth.CSRFCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == auth.SessionCookieName,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// logoutHandler ends the session of the request.
+func (j authHandlers) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if p, _ := auth.PrincipalFrom(r.Context()); p.Session != "" {
+		if err := j.Sessions().Delete(r.Context(), p.Session); err != nil {
+			handleError(err, w)
+			return
+		}
+	}
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("logged out"))
+}
@@ -0,0 +1,101 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+)
+
+func TestCookieSessions(t *testing.T) {
+	doRequest := createRequester(t)
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.FailNow()
+	}
+	ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().AddDate(1, 0, 0)}))
+	defer ts.Close()
+
+	doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v2/user/register", prepareParams(t, map[string]interface{}{
+		"email":         "test@mail.com",
+		"password":      "somepass",
+		"favorite_cake": "cheesecake",
+	})))
+
+	req, _ := newJSONRequest(http.MethodPost, ts.URL+"/v2/user/jwt", prepareParams(t, map[string]interface{}{
+		"email":    "test@mail.com",
+		"password": "somepass",
+		"cookie":   true,
+	}))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	var csrf csrfResponse
+	if err := json.Unmarshal(body, &csrf); err != nil || csrf.CSRFToken == "" {
+		t.Fatal("unexpected login response", string(body))
+	}
+	var session *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == auth.SessionCookieName {
+			session = c
+		}
+	}
+	if session == nil || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode {
+		t.Fatal("unexpected session cookie", res.Header.Values("Set-Cookie"))
+	}
+
+	withCookie := func(method, path string, params map[string]interface{}, csrfToken string) parsedResponse {
+		req, err := newJSONRequest(method, ts.URL+path, prepareParams(t, params))
+		if err == nil {
+			req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: session.Value})
+			if csrfToken != "" {
+				req.Header.Set(auth.CSRFHeaderName, csrfToken)
+			}
+		}
+		return doRequest(req, err)
+	}
+	cakeParams := map[string]interface{}{"favorite_cake": "muffin"}
+
+	t.Run("reads need no CSRF token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/user/me", nil)
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: session.Value})
+		resp := doRequest(req, err)
+		assertStatus(t, 200, resp)
+		assertBody(t, "cheesecaketest@mail.com", resp)
+	})
+	t.Run("changes need the CSRF token", func(t *testing.T) {
+		resp := withCookie(http.MethodPost, "/v2/user/favorite_cake", cakeParams, "")
+		assertStatus(t, 403, resp)
+		assertBody(t, "missing or invalid CSRF token", resp)
+
+		resp = withCookie(http.MethodPost, "/v2/user/favorite_cake", cakeParams, j.CSRFToken("another session"))
+		assertStatus(t, 403, resp)
+
+		resp = withCookie(http.MethodPost, "/v2/user/favorite_cake", cakeParams, csrf.CSRFToken)
+		assertStatus(t, 200, resp)
+	})
+	t.Run("bearer mode needs no CSRF token", func(t *testing.T) {
+		token := getBody(doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v2/user/jwt", prepareParams(t, map[string]interface{}{
+			"email":    "test@mail.com",
+			"password": "somepass",
+		}))))
+		req, err := newJSONRequest(http.MethodPost, ts.URL+"/v2/user/favorite_cake", prepareParams(t, cakeParams))
+		req.Header.Set("Authorization", "Bearer "+token)
+		assertStatus(t, 200, doRequest(req, err))
+	})
+	t.Run("logout", func(t *testing.T) {
+		resp := withCookie(http.MethodPost, "/v2/user/logout", nil, csrf.CSRFToken)
+		assertStatus(t, 200, resp)
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v2/user/me", nil)
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: session.Value})
+		assertBody(t, "unauthorized", doRequest(req, err))
+	})
+}
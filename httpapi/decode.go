@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang-api/domain"
+)
+
+const (
+	// maxBodySize limits every request body, the API only takes small JSON objects.
+	maxBodySize = 64 << 10
+
+	// encoding/json and net/http don't have typed errors for these.
+	errTooLargeMessage    = "http: request body too large"
+	unknownFieldErrPrefix = "json: unknown field "
+)
+
+var (
+	errBodyTooLarge     = &requestError{http.StatusRequestEntityTooLarge, errors.New("request body too large")}
+	errUnsupportedType  = &requestError{http.StatusUnsupportedMediaType, errors.New("Content-Type should be application/json")}
+	errMalformedBody    = &requestError{http.StatusBadRequest, errors.New("request body is not valid JSON")}
+	errEmptyBody        = &requestError{http.StatusBadRequest, errors.New("request body is empty")}
+	errTrailingBodyData = &requestError{http.StatusBadRequest, errors.New("request body should contain a single JSON object")}
+)
+
+// requestError is an error in the request itself rather than in its params,
+// handleError answers it with Status.
+type requestError struct {
+	Status int
+	Err    error
+}
+
+func (e *requestError) Error() string {
+	return e.Err.Error()
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == contentTypeJSON
+}
+
+// decodeJSON reads the body into dst. Only a single JSON object with known
+// fields is accepted.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	if !isJSONRequest(r) {
+		return errUnsupportedType
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		return errEmptyBody
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return errMalformedBody
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return localize(r, domain.FieldErrors{domain.NewFieldError(typeErr.Field, "type", jsonTypeName(typeErr.Type.Kind().String()))})
+	case errors.As(err, &typeErr):
+		return errors.New("request body should be an object")
+	case strings.HasPrefix(err.Error(), unknownFieldErrPrefix):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), unknownFieldErrPrefix), `"`)
+		return localize(r, domain.FieldErrors{domain.NewFieldError(field, "unknown_field", "")})
+	case err.Error() == errTooLargeMessage:
+		return errBodyTooLarge
+	default:
+		return errMalformedBody
+	}
+
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		if err != nil && err.Error() == errTooLargeMessage {
+			return errBodyTooLarge
+		}
+		return errTrailingBodyData
+	}
+	return nil
+}
+
+func jsonTypeName(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "integer"
+	case strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "struct", kind == "map":
+		return "object"
+	}
+	return kind
+}
+
+// requireJSON rejects bodies that are too large, not JSON or malformed
+// before the handler runs.
+func requireJSON(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !isJSONRequest(r) {
+			handleError(errUnsupportedType, rw)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxBodySize))
+		if err != nil {
+			handleError(errBodyTooLarge, rw)
+			return
+		}
+		if !json.Valid(body) {
+			handleError(errMalformedBody, rw)
+			return
+		}
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		h.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,5 @@
+package httpapi
+
+type EmailConfirmParams struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang-api/domain"
+	"golang-api/service"
+)
+
+func userETag(u domain.User) string {
+	return `"` + strconv.Itoa(u.Version) + `"`
+}
+
+func setETag(w http.ResponseWriter, u domain.User) {
+	w.Header().Set("ETag", userETag(u))
+}
+
+// ifMatch checks the If-Match header of the request against the current
+// version of the user. Requests without the header always match.
+func ifMatch(r *http.Request, u domain.User) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == userETag(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// withIfMatch makes the service check the If-Match header of the request
+// against the stored user right before updating it.
+func withIfMatch(r *http.Request) context.Context {
+	return service.WithPrecondition(r.Context(), func(u domain.User) bool {
+		return ifMatch(r, u)
+	})
+}
@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/events"
+)
+
+const contentTypeEventStream = "text/event-stream"
+
+// eventsKeepAlive is how often idle streams get a comment, so proxies
+// don't close them.
+var eventsKeepAlive = 15 * time.Second
+
+// eventsRecheck is how often open streams check the credentials of the
+// client again, so revoked sessions and keys or lost roles end them.
+var eventsRecheck = 30 * time.Second
+
+var (
+	errStreamingUnsupported = errors.New("streaming is not supported")
+	errStreamBanned         = errors.New("you are banned")
+)
+
+func (u *UserService) adminEventsHandler(w http.ResponseWriter, r *http.Request, j *auth.JWTService) {
+	streamEvents(w, r, u.users.Events(), func(events.Event) bool { return true }, nil,
+		u.allowed(r, j, "AdminRole"))
+}
+
+// userEventsHandler tells users about bans, deletions and password changes
+// of their account. A ban or a deletion ends the stream, such users can't
+// reconnect.
+func (u *UserService) userEventsHandler(w http.ResponseWriter, r *http.Request, j *auth.JWTService) {
+	email := currentUser(r).Email
+	streamEvents(w, r, u.users.Events(), func(e events.Event) bool {
+		return e.Email == email &&
+			(e.Type == events.UserBanned || e.Type == events.UserDeleted || e.Type == events.PasswordChanged)
+	}, func(e events.Event) bool {
+		return e.Type == events.UserBanned || e.Type == events.UserDeleted
+	}, u.allowed(r, j, "UserRole"))
+}
+
+// allowed authenticates the request again the way Authenticate and
+// RequireRole did when the stream was opened.
+func (u *UserService) allowed(r *http.Request, j *auth.JWTService, role string) func() error {
+	return func() error {
+		p, err := j.Authenticate(r, u.repository)
+		if err != nil {
+			return err
+		}
+		if p.User.Banned(time.Now()) {
+			return errStreamBanned
+		}
+		return p.Authorize(role, r.Method)
+	}
+}
+
+// streamEvents sends the matching events as Server-Sent Events until the
+// client goes away or an event that ends the stream was sent. Clients
+// reconnecting with Last-Event-ID first get the events they missed, a
+// "reset" event tells them when some of those are gone. The stream also
+// ends once allowed fails.
+func streamEvents(w http.ResponseWriter, r *http.Request, bus *events.Bus, match, ends func(events.Event) bool, allowed func() error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handleError(errStreamingUnsupported, w)
+		return
+	}
+	var sub *events.Subscription
+	var replay []events.Event
+	complete := true
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			handleError(&requestError{http.StatusBadRequest, errors.New("invalid Last-Event-ID")}, w)
+			return
+		}
+		sub, replay, complete = bus.Resume(id, match)
+	} else {
+		sub = bus.Subscribe(match)
+	}
+	defer bus.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", contentTypeEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range replay {
+		writeEvent(w, e)
+		if ends != nil && ends(e) {
+			flusher.Flush()
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	recheck := time.NewTicker(eventsRecheck)
+	defer recheck.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// too slow, the client resumes from the last event it got
+				return
+			}
+			writeEvent(w, e)
+			flusher.Flush()
+			if ends != nil && ends(e) {
+				return
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-recheck.C:
+			if allowed() != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
@@ -0,0 +1,180 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/service"
+)
+
+// openStream connects to an event stream and returns its reader.
+func openStream(t *testing.T, url, token, lastID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readEvent returns the id and the type of the next event of a stream.
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	id, event := "", ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal("stream ended:", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return id, event
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		}
+	}
+}
+
+func assertEvent(t *testing.T, expected string, r *bufio.Reader) string {
+	t.Helper()
+	id, event := readEvent(t, r)
+	if event != expected {
+		t.Errorf("Unexpected event. Expected: %s, actual: %s", expected, event)
+	}
+	return id
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*UserService, *auth.JWTService, *httptest.Server, string, string) {
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().Add(time.Hour)}))
+		t.Cleanup(ts.Close)
+
+		u.users.Register(ctx, service.RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		user, _ := u.repository.Get(ctx, "test@mail.com")
+		userToken, _ := j.GenearateJWT(user)
+		u.users.AddAdmin(ctx, "admin@mail.com", "adminadmin")
+		admin, _ := u.repository.Get(ctx, "admin@mail.com")
+		adminToken, _ := j.GenerateMFAJWT(admin)
+		return u, j, ts, userToken, adminToken
+	}
+
+	t.Run("admin stream resumes", func(t *testing.T) {
+		u, _, ts, userToken, adminToken := setup(t)
+		admin, _ := u.repository.Get(ctx, "admin@mail.com")
+
+		resp, _ := openStream(t, ts.URL+"/v2/admin/events", userToken, "")
+		assertStatus(t, 422, parsedResponse{status: resp.StatusCode})
+
+		resp, stream := openStream(t, ts.URL+"/v2/admin/events", adminToken, "")
+		if resp.Header.Get("Content-Type") != contentTypeEventStream {
+			t.Fatal("unexpected Content-Type", resp.Header.Get("Content-Type"))
+		}
+		u.users.Ban(ctx, admin, "test@mail.com", "making mess", time.Time{})
+		id := assertEvent(t, "user.banned", stream)
+		resp.Body.Close()
+
+		u.users.Unban(ctx, admin, "test@mail.com")
+		u.users.UpdateProfile(ctx, "test@mail.com", service.ProfileParams{FavoriteCake: "napoleon"})
+		_, stream = openStream(t, ts.URL+"/v2/admin/events", adminToken, id)
+		assertEvent(t, "user.unbanned", stream)
+		assertEvent(t, "user.profile_updated", stream)
+
+		resp, _ = openStream(t, ts.URL+"/v2/admin/events", adminToken, "last")
+		assertStatus(t, 400, parsedResponse{status: resp.StatusCode})
+	})
+
+	t.Run("user stream", func(t *testing.T) {
+		u, _, ts, userToken, _ := setup(t)
+		admin, _ := u.repository.Get(ctx, "admin@mail.com")
+
+		_, stream := openStream(t, ts.URL+"/v2/user/events", userToken, "")
+		// other users and profile updates are not in the stream
+		u.users.Register(ctx, service.RegisterParams{Email: "other@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		u.users.UpdateProfile(ctx, "test@mail.com", service.ProfileParams{FavoriteCake: "napoleon"})
+		u.users.ChangePassword(ctx, "test@mail.com", "otherpass")
+		assertEvent(t, "user.password_changed", stream)
+
+		u.users.Ban(ctx, admin, "test@mail.com", "making mess", time.Time{})
+		assertEvent(t, "user.banned", stream)
+		if _, err := stream.ReadString('\n'); err != io.EOF {
+			t.Error("stream did not end after the ban", err)
+		}
+
+		resp, _ := openStream(t, ts.URL+"/v2/user/events", userToken, "")
+		assertStatus(t, 401, parsedResponse{status: resp.StatusCode})
+	})
+
+	t.Run("revoked streams end", func(t *testing.T) {
+		defer func(d time.Duration) { eventsRecheck = d }(eventsRecheck)
+		eventsRecheck = 10 * time.Millisecond
+		u, j, ts, _, adminToken := setup(t)
+		admin, _ := u.repository.Get(ctx, "admin@mail.com")
+
+		_, stream := openStream(t, ts.URL+"/v2/admin/events", adminToken, "")
+		u.users.Ban(ctx, admin, "test@mail.com", "making mess", time.Time{})
+		assertEvent(t, "user.banned", stream)
+
+		j.RevokeUser(ctx, "admin@mail.com")
+		assertEnds(t, stream)
+	})
+
+	t.Run("shutdown ends streams", func(t *testing.T) {
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shutdown, endStreams := context.WithCancel(ctx)
+		ts := httptest.NewServer(NewRouter(u, j, RouterConfig{Shutdown: shutdown}))
+		t.Cleanup(ts.Close)
+		u.users.Register(ctx, service.RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		user, _ := u.repository.Get(ctx, "test@mail.com")
+		token, _ := j.GenearateJWT(user)
+
+		resp, stream := openStream(t, ts.URL+"/v2/user/events", token, "")
+		assertStatus(t, 200, parsedResponse{status: resp.StatusCode})
+		endStreams()
+		assertEnds(t, stream)
+	})
+}
+
+// assertEnds checks that the server closes the stream soon.
+func assertEnds(t *testing.T, stream *bufio.Reader) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.ReadString('\n')
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Error("stream did not end", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("stream did not end")
+	}
+}
@@ -0,0 +1,29 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"golang-api/graphqlapi"
+)
+
+const graphqlPath = "/graphql"
+
+var errEmptyQuery = &requestError{http.StatusBadRequest, errors.New("query is required")}
+
+// graphqlHandler runs GraphQL requests. Credentials are optional, every
+// field checks the role it needs and reports its own error.
+func graphqlHandler(schema *graphqlapi.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &graphqlapi.Request{}
+		if err := decodeJSON(w, r, req); err != nil {
+			handleError(err, w)
+			return
+		}
+		if req.Query == "" {
+			handleError(errEmptyQuery, w)
+			return
+		}
+		writeJSON(w, http.StatusOK, schema.Execute(r.Context(), *req))
+	}
+}
@@ -0,0 +1,128 @@
+// Package httpapi is the HTTP transport of the API: the handlers, the
+// middleware chain and the versioned router.
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"golang-api/auth"
+	"golang-api/service"
+)
+
+// ProfileParams are the fields users may change about themselves.
+type ProfileParams = service.ProfileParams
+
+type PasswordParams struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func getCakeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(currentUser(r).FavoriteCake))
+}
+func getMeHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	setETag(w, u)
+	switch negotiate(r, contentTypeText, contentTypeJSON) {
+	case contentTypeJSON:
+		writeJSON(w, http.StatusOK, newUserView(u, true))
+	case contentTypeText:
+		w.Write([]byte(u.FavoriteCake))
+		w.Write([]byte(u.Email))
+	default:
+		handleErrorCode(errNotAcceptable, http.StatusNotAcceptable, w)
+	}
+}
+func getEmailHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(currentUser(r).Email))
+}
+func wrapJwt(
+	jwt *auth.JWTService,
+	f func(http.ResponseWriter, *http.Request, *auth.JWTService),
+) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		f(rw, r, jwt)
+	}
+}
+func (uServ UserService) updateCakeHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	params := &ProfileParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	updated, err := uServ.users.UpdateProfile(withIfMatch(r), u.Email, *params)
+	if err != nil {
+		handleError(localizeError(r, err), w)
+		return
+	}
+	setETag(w, updated)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("cake updated"))
+}
+func (uServ UserService) updateEmailHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	params := &EmailParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	email, err := uServ.users.RequestEmailChange(withIfMatch(r), u.Email, params.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("confirmation sent to " + email))
+}
+func (uServ UserService) confirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	params := &EmailConfirmParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := uServ.users.ConfirmEmailChange(r.Context(), params.Token); err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("email updated"))
+}
+func (uServ UserService) updatePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	params := &PasswordParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	updated, err := uServ.users.ChangePassword(withIfMatch(r), u.Email, params.Password)
+	if err != nil {
+		handleError(localizeError(r, err), w)
+		return
+	}
+	setETag(w, updated)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("password updated"))
+}
+
+// AddAdmin creates the admin user from CAKE_ADMIN_EMAIL and CAKE_ADMIN_PASSWORD.
+func (uServ *UserService) AddAdmin(ctx context.Context) error {
+	return uServ.users.AddAdmin(ctx, os.Getenv("CAKE_ADMIN_EMAIL"), os.Getenv("CAKE_ADMIN_PASSWORD"))
+}
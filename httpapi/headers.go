@@ -0,0 +1,263 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-api/auth"
+)
+
+// CORSPolicy says which other origins may call the API from a browser.
+// An empty AllowedOrigins turns CORS off, "*" allows every origin.
+type CORSPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer.
+	MaxAge time.Duration
+}
+
+// SecurityHeaders are sent with every response. Empty values are not sent.
+type SecurityHeaders struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security, 0 disables it.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+	FrameOptions          string
+	// NoStore forbids caching of the responses.
+	NoStore bool
+}
+
+type HeaderPolicy struct {
+	CORS     CORSPolicy
+	Security SecurityHeaders
+}
+
+// HeaderPolicies maps path prefixes to their policies, the longest
+// matching prefix wins. Prefixes are relative to the version prefix,
+// "/admin" applies to /admin, /v1/admin and /v2/admin. The "" prefix is
+// the default.
+type HeaderPolicies map[string]HeaderPolicy
+
+func DefaultHeaderPolicy() HeaderPolicy {
+	return HeaderPolicy{
+		CORS: CORSPolicy{
+			AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "Accept", "Accept-Language", "If-Match", auth.CSRFHeaderName},
+			ExposedHeaders: []string{"ETag", "Deprecation", "Sunset", "Link"},
+			MaxAge:         10 * time.Minute,
+		},
+		Security: SecurityHeaders{
+			HSTSMaxAge:            365 * 24 * time.Hour,
+			HSTSIncludeSubdomains: true,
+			ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+			ReferrerPolicy:        "no-referrer",
+			FrameOptions:          "DENY",
+		},
+	}
+}
+
+// AdminHeaderPolicy is stricter: no other origin may call admin routes
+// unless configured, and the responses are never cached.
+func AdminHeaderPolicy() HeaderPolicy {
+	policy := DefaultHeaderPolicy()
+	policy.CORS.AllowedOrigins = nil
+	policy.CORS.MaxAge = 0
+	policy.Security.NoStore = true
+	return policy
+}
+
+// DefaultHeaderPolicies gives /admin and /graphql, which runs admin
+// mutations, the admin policy and every other path the default one.
+func DefaultHeaderPolicies() HeaderPolicies {
+	admin := AdminHeaderPolicy()
+	return HeaderPolicies{"": DefaultHeaderPolicy(), "/admin": admin, graphqlPath: admin}
+}
+
+func (p CORSPolicy) validate() error {
+	if p.AllowCredentials && containsFold(p.AllowedOrigins, "*") {
+		return errors.New("CORS credentials can't be allowed for every origin")
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p CORSPolicy) allowOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+func (p CORSPolicy) setOrigin(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Access-Control-Allow-Origin", allowed)
+	if p.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflight answers an OPTIONS request of a browser asking whether the
+// real request is allowed. Disallowed requests get no CORS headers, the
+// browser blocks them then.
+func (p CORSPolicy) preflight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	allowed := p.allowOrigin(r.Header.Get("Origin"))
+	method := r.Header.Get("Access-Control-Request-Method")
+	if allowed == "" || !containsFold(p.AllowedMethods, method) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.TrimSpace(header); header != "" && !containsFold(p.AllowedHeaders, header) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	p.setOrigin(w, allowed)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+	if p.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s SecurityHeaders) set(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("X-Content-Type-Options", "nosniff")
+	if s.HSTSMaxAge > 0 {
+		value := fmt.Sprintf("max-age=%d", int(s.HSTSMaxAge.Seconds()))
+		if s.HSTSIncludeSubdomains {
+			value += "; includeSubDomains"
+		}
+		h.Set("Strict-Transport-Security", value)
+	}
+	if s.ContentSecurityPolicy != "" {
+		h.Set("Content-Security-Policy", s.ContentSecurityPolicy)
+	}
+	if s.ReferrerPolicy != "" {
+		h.Set("Referrer-Policy", s.ReferrerPolicy)
+	}
+	if s.FrameOptions != "" {
+		h.Set("X-Frame-Options", s.FrameOptions)
+	}
+	if s.NoStore {
+		h.Set("Cache-Control", "no-store")
+	}
+}
+
+func (ps HeaderPolicies) policyFor(path string) HeaderPolicy {
+	for _, version := range []string{"/v1", "/v2"} {
+		if path == version || strings.HasPrefix(path, version+"/") {
+			path = strings.TrimPrefix(path, version)
+			break
+		}
+	}
+	best, bestLen := DefaultHeaderPolicy(), -1
+	for prefix, policy := range ps {
+		if len(prefix) > bestLen && (path == prefix || strings.HasPrefix(path, prefix+"/") || prefix == "") {
+			best, bestLen = policy, len(prefix)
+		}
+	}
+	return best
+}
+
+// middleware sets the headers of the policy on responses of matched routes.
+func (ps HeaderPolicies) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := ps.policyFor(r.URL.Path)
+		policy.Security.set(w)
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Add("Vary", "Origin")
+			if allowed := policy.CORS.allowOrigin(origin); allowed != "" {
+				policy.CORS.setOrigin(w, allowed)
+				if len(policy.CORS.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.CORS.ExposedHeaders, ", "))
+				}
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// methodNotAllowed answers requests to known paths with a method no route
+// has. Preflight requests always end up here since routes don't register
+// OPTIONS, and mux skips middlewares for them.
+func (ps HeaderPolicies) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	policy := ps.policyFor(r.URL.Path)
+	policy.Security.set(w)
+	if r.Method == http.MethodOptions && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != "" {
+		policy.CORS.preflight(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
+
+// HeaderPoliciesFromEnv configures CORS with CAKE_CORS_ORIGINS and
+// CAKE_ADMIN_CORS_ORIGINS (comma separated), CAKE_CORS_CREDENTIALS=true
+// and CAKE_CORS_MAX_AGE in seconds. CAKE_HSTS_MAX_AGE=0 turns HSTS off
+// for servers without TLS. /graphql runs admin mutations, so it gets the
+// admin policy.
+func HeaderPoliciesFromEnv() (HeaderPolicies, error) {
+	def, admin := DefaultHeaderPolicy(), AdminHeaderPolicy()
+	def.CORS.AllowedOrigins = splitList(os.Getenv("CAKE_CORS_ORIGINS"))
+	admin.CORS.AllowedOrigins = splitList(os.Getenv("CAKE_ADMIN_CORS_ORIGINS"))
+	credentials := os.Getenv("CAKE_CORS_CREDENTIALS") == "true"
+	def.CORS.AllowCredentials, admin.CORS.AllowCredentials = credentials, credentials
+	if v := os.Getenv("CAKE_CORS_MAX_AGE"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		def.CORS.MaxAge = time.Duration(seconds) * time.Second
+	}
+	if v := os.Getenv("CAKE_HSTS_MAX_AGE"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		def.Security.HSTSMaxAge = time.Duration(seconds) * time.Second
+		admin.Security.HSTSMaxAge = def.Security.HSTSMaxAge
+	}
+	for _, policy := range []HeaderPolicy{def, admin} {
+		if err := policy.CORS.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return HeaderPolicies{"": def, "/admin": admin, graphqlPath: admin}, nil
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,160 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+)
+
+func TestHeaders(t *testing.T) {
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.FailNow()
+	}
+	def, admin := DefaultHeaderPolicy(), AdminHeaderPolicy()
+	def.CORS.AllowedOrigins = []string{"https://app.example.com"}
+	def.CORS.AllowCredentials = true
+	admin.CORS.AllowedOrigins = []string{"https://admin.example.com"}
+	ts := httptest.NewServer(NewRouter(u, j, RouterConfig{
+		LegacySunset: time.Now().AddDate(1, 0, 0),
+		Headers:      HeaderPolicies{"": def, "/admin": admin},
+	}))
+	defer ts.Close()
+
+	do := func(method, path string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+	preflight := func(path, origin, method, headers string) *http.Response {
+		return do(http.MethodOptions, path, map[string]string{
+			"Origin":                         origin,
+			"Access-Control-Request-Method":  method,
+			"Access-Control-Request-Headers": headers,
+		})
+	}
+
+	t.Run("preflight of an allowed origin", func(t *testing.T) {
+		res := preflight("/v2/user/me", "https://app.example.com", "GET", "authorization, x-csrf-token")
+		if res.StatusCode != 204 ||
+			res.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+			res.Header.Get("Access-Control-Allow-Credentials") != "true" ||
+			res.Header.Get("Access-Control-Max-Age") != "600" {
+			t.Error("unexpected preflight answer", res.StatusCode, res.Header)
+		}
+	})
+	t.Run("preflight of others is not allowed", func(t *testing.T) {
+		cases := []*http.Response{
+			preflight("/v2/user/me", "https://evil.example.com", "GET", ""),
+			preflight("/v2/user/me", "https://app.example.com", "PUT", ""),
+			preflight("/v2/user/me", "https://app.example.com", "GET", "X-Custom"),
+		}
+		for i, res := range cases {
+			if res.Header.Get("Access-Control-Allow-Origin") != "" {
+				t.Errorf("case %d: unexpected CORS headers %v", i, res.Header)
+			}
+		}
+	})
+	t.Run("admin routes have their own policy", func(t *testing.T) {
+		res := preflight("/v1/admin/ban", "https://app.example.com", "POST", "")
+		if res.Header.Get("Access-Control-Allow-Origin") != "" {
+			t.Error("app origin may not call admin routes")
+		}
+		res = preflight("/admin/ban", "https://admin.example.com", "POST", "")
+		if res.Header.Get("Access-Control-Allow-Origin") != "https://admin.example.com" {
+			t.Error("admin origin should be allowed", res.Header)
+		}
+		res = do(http.MethodGet, "/v2/admin/users", nil)
+		if res.Header.Get("Cache-Control") != "no-store" {
+			t.Error("admin responses should not be cached")
+		}
+	})
+	t.Run("security headers", func(t *testing.T) {
+		res := do(http.MethodGet, "/v2/user/me", map[string]string{"Origin": "https://app.example.com"})
+		expected := map[string]string{
+			"X-Content-Type-Options":        "nosniff",
+			"Strict-Transport-Security":     "max-age=31536000; includeSubDomains",
+			"Content-Security-Policy":       "default-src 'none'; frame-ancestors 'none'",
+			"Referrer-Policy":               "no-referrer",
+			"Access-Control-Allow-Origin":   "https://app.example.com",
+			"Access-Control-Expose-Headers": "ETag, Deprecation, Sunset, Link",
+		}
+		for name, value := range expected {
+			if res.Header.Get(name) != value {
+				t.Errorf("%s: expected %q, actual %q", name, value, res.Header.Get(name))
+			}
+		}
+		if res.Header.Get("Cache-Control") != "" {
+			t.Error("user responses may be cached")
+		}
+	})
+	t.Run("other methods are still not allowed", func(t *testing.T) {
+		if res := do(http.MethodPut, "/v2/user/me", nil); res.StatusCode != 405 {
+			t.Error("unexpected status", res.StatusCode)
+		}
+	})
+	t.Run("graphql has the admin policy", func(t *testing.T) {
+		t.Setenv("CAKE_CORS_ORIGINS", "https://app.example.com")
+		t.Setenv("CAKE_ADMIN_CORS_ORIGINS", "https://admin.example.com")
+		t.Setenv("CAKE_CORS_CREDENTIALS", "true")
+		policies, err := HeaderPoliciesFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().AddDate(1, 0, 0), Headers: policies}))
+		defer ts.Close()
+		preflight := func(origin string) *http.Response {
+			req, _ := http.NewRequest(http.MethodOptions, ts.URL+"/graphql", nil)
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			return res
+		}
+		if res := preflight("https://app.example.com"); res.Header.Get("Access-Control-Allow-Origin") != "" {
+			t.Error("app origin may not send graphql mutations", res.Header)
+		}
+		res := preflight("https://admin.example.com")
+		if res.Header.Get("Access-Control-Allow-Origin") != "https://admin.example.com" ||
+			res.Header.Get("Access-Control-Allow-Credentials") != "true" {
+			t.Error("admin origin should be allowed", res.Header)
+		}
+	})
+	t.Run("admin paths have the admin policy by default", func(t *testing.T) {
+		ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().AddDate(1, 0, 0)}))
+		defer ts.Close()
+		for path, noStore := range map[string]bool{"/v2/user/me": false, "/v2/admin/users": true, "/v1/admin/users": true, "/graphql": true} {
+			res, err := http.Get(ts.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if (res.Header.Get("Cache-Control") == "no-store") != noStore {
+				t.Error("unexpected policy of", path, res.Header)
+			}
+		}
+	})
+	t.Run("credentials need explicit origins", func(t *testing.T) {
+		policy := CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+		if policy.validate() == nil {
+			t.Error("wildcard origin with credentials was accepted")
+		}
+	})
+}
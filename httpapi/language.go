@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang-api/domain"
+)
+
+// preferredLanguage picks the best language of the catalogue from the
+// Accept-Language header, "uk-UA" is served by "uk".
+func preferredLanguage(r *http.Request) string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.ToLower(strings.TrimSpace(fields[0]))
+		if dash := strings.Index(lang, "-"); dash > 0 {
+			lang = lang[:dash]
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+				q = parsed
+			}
+		}
+		if domain.HasLanguage(lang) && q > 0 {
+			langs = append(langs, weighted{lang, q})
+		}
+	}
+	if len(langs) == 0 {
+		return domain.DefaultLanguage
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	return langs[0].lang
+}
+
+// localize translates the messages of field errors to the language of the request.
+func localize(r *http.Request, errs domain.FieldErrors) domain.FieldErrors {
+	return errs.Localize(preferredLanguage(r))
+}
+
+// localizeError translates the field errors returned by the service,
+// other errors are returned as they are.
+func localizeError(r *http.Request, err error) error {
+	var errs domain.FieldErrors
+	if errors.As(err, &errs) {
+		return localize(r, errs)
+	}
+	return err
+}
+
+// validateRequest validates params and translates the violations to the
+// language of the request.
+func validateRequest(r *http.Request, params interface{}) error {
+	if errs := domain.Validate(params); errs != nil {
+		return localize(r, errs)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+type logWriter struct {
+	http.ResponseWriter
+	statusCode int
+	response   bytes.Buffer
+	skipBody   bool
+}
+
+func (w *logWriter) WriteHeader(status int) {
+	w.ResponseWriter.WriteHeader(status)
+	w.statusCode = status
+}
+func (w *logWriter) Write(p []byte) (int, error) {
+	// streams never end, only their status is logged
+	if !w.skipBody && w.Header().Get("Content-Type") != contentTypeEventStream {
+		w.response.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *logWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+func logRequest(h http.Handler) http.Handler {
+	return logRequests(h, true)
+}
+
+// logRequestRedacted logs routes that carry credentials. Only the path,
+// status and duration make it to the log.
+func logRequestRedacted(h http.Handler) http.Handler {
+	return logRequests(h, false)
+}
+
+func logRequests(h http.Handler, withBodies bool) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		writer := &logWriter{ResponseWriter: rw, skipBody: !withBodies}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxBodySize))
+		if err != nil && err.Error() == errTooLargeMessage {
+			log.Println("Request body is too large", r.URL.Path)
+			handleError(errBodyTooLarge, rw)
+			return
+		}
+		if err != nil {
+			log.Println("Could not read request body", err)
+			handleError(errors.New("could not read request"), rw)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		started := time.Now()
+		h.ServeHTTP(writer, r)
+		done := time.Since(started)
+		if !withBodies {
+			log.Printf("PATH: %s -> %d. Finished in %v.", r.URL.Path, writer.statusCode, done)
+			return
+		}
+		log.Printf(
+			"PATH: %s -> %d. Finished in %v.\n\tParams: %s\n\tResponse: %s",
+			r.URL.Path,
+			writer.statusCode,
+			done,
+			string(body),
+			writer.response.String(),
+		)
+	})
+}
@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"golang-api/auth"
+)
+
+type JWTParams struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Cookie asks for a cookie session, see writeSession.
+	Cookie bool `json:"cookie,omitempty"`
+}
+
+func (u *UserService) JWT(w http.ResponseWriter, r *http.Request, jwtService *auth.JWTService) {
+	params := &JWTParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	user, err := u.users.Login(r.Context(), params.Email, params.Password)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	if user.MFA.Enabled {
+		token, err := jwtService.GenerateMFAPendingJWT(user)
+		if err != nil {
+			handleError(err, w)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, mfaChallenge{MFARequired: true, MFAToken: token})
+		return
+	}
+
+	token, session, err := jwtService.IssueSession(r, user, auth.LevelPassword)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	writeSession(w, jwtService, token, session, params.Cookie)
+}
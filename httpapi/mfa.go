@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/service"
+)
+
+var (
+	errMFAEnabled     = errors.New("two-factor authentication is already enabled")
+	errMFANotEnabled  = errors.New("two-factor authentication is not enabled")
+	errMFANotEnrolled = errors.New("start two-factor enrolment first")
+)
+
+type MFACodeParams struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type MFALoginParams struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+	// Cookie asks for a cookie session, see writeSession.
+	Cookie bool `json:"cookie,omitempty"`
+}
+
+type mfaEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type mfaRecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+func (uServ UserService) enrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	if u.MFA.Enabled {
+		handleError(errMFAEnabled, w)
+		return
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	enrolled := u
+	enrolled.MFA = domain.MFAState{Secret: secret}
+	if err := uServ.repository.CompareAndUpdate(r.Context(), u.Email, u.Version, enrolled); err != nil {
+		handleError(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, mfaEnrolment{Secret: secret, URI: auth.TOTPURI(u.Email, secret)})
+}
+
+func (uServ UserService) confirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	params := &MFACodeParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if u.MFA.Enabled {
+		handleError(errMFAEnabled, w)
+		return
+	}
+	if u.MFA.Secret == "" {
+		handleError(errMFANotEnrolled, w)
+		return
+	}
+	step, ok := auth.VerifyTOTP(u.MFA.Secret, params.Code, time.Now(), u.MFA.LastStep)
+	if !ok {
+		handleError(service.ErrInvalidMFACode, w)
+		return
+	}
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	confirmed := u
+	confirmed.MFA = domain.MFAState{Secret: u.MFA.Secret, Enabled: true, LastStep: step, RecoveryCodes: hashes}
+	if err := uServ.repository.CompareAndUpdate(r.Context(), u.Email, u.Version, confirmed); err != nil {
+		handleError(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, mfaRecoveryCodes{RecoveryCodes: codes})
+}
+
+func (uServ UserService) disableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	params := &MFACodeParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if !u.MFA.Enabled {
+		handleError(errMFANotEnabled, w)
+		return
+	}
+	if _, ok := auth.CheckSecondFactor(u, params.Code); !ok {
+		handleError(service.ErrInvalidMFACode, w)
+		return
+	}
+	disabled := u
+	disabled.MFA = domain.MFAState{}
+	if err := uServ.repository.CompareAndUpdate(r.Context(), u.Email, u.Version, disabled); err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("two-factor authentication disabled"))
+}
+
+// MFALogin is the second login step, it trades the token issued by JWT
+// and a code for a session. Too many wrong codes lock the user out for a
+// while.
+func (u *UserService) MFALogin(w http.ResponseWriter, r *http.Request, jwtService *auth.JWTService) {
+	params := &MFALoginParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	verified, err := jwtService.CompleteMFALogin(params.MFAToken, func(email string) (domain.User, error) {
+		return u.users.VerifySecondFactor(r.Context(), email, params.Code)
+	})
+	if errors.Is(err, auth.ErrMFALocked) {
+		handleErrorCode(err, http.StatusTooManyRequests, w)
+		return
+	}
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	token, session, err := jwtService.IssueSession(r, verified, auth.LevelMFA)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	writeSession(w, jwtService, token, session, params.Cookie)
+}
@@ -0,0 +1,192 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/service"
+)
+
+func TestMFA(t *testing.T) {
+	t.Run("enrolment and two-step login", func(t *testing.T) {
+		doRequest := createRequester(t)
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		register := httptest.NewServer(http.HandlerFunc(u.Register))
+		login := httptest.NewServer(wrapJwt(j, u.JWT))
+		mfaLogin := httptest.NewServer(wrapJwt(j, u.MFALogin))
+		enroll := httptest.NewServer(jwtAuth(j, u.repository, u.enrollMFAHandler))
+		confirm := httptest.NewServer(jwtAuth(j, u.repository, u.confirmMFAHandler))
+		disable := httptest.NewServer(jwtAuth(j, u.repository, u.disableMFAHandler))
+		me := httptest.NewServer(jwtAuth(j, u.repository, getMeHandler))
+		for _, ts := range []*httptest.Server{register, login, mfaLogin, enroll, confirm, disable, me} {
+			defer ts.Close()
+		}
+		authorized := func(url, token string, params map[string]interface{}) parsedResponse {
+			req, err := newJSONRequest(http.MethodPost, url, prepareParams(t, params))
+			req.Header.Set("Authorization", "Bearer "+token)
+			return doRequest(req, err)
+		}
+
+		doRequest(newJSONRequest(http.MethodPost, register.URL, prepareParams(t, map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		})))
+		credentials := map[string]interface{}{"email": "test@mail.com", "password": "somepass"}
+		passwordJwt := getBody(doRequest(newJSONRequest(http.MethodPost, login.URL, prepareParams(t, credentials))))
+
+		resp := authorized(enroll.URL, passwordJwt, map[string]interface{}{})
+		assertStatus(t, 200, resp)
+		var enrolment mfaEnrolment
+		if err := json.Unmarshal(resp.body, &enrolment); err != nil || enrolment.Secret == "" {
+			t.Fatal("unexpected enrolment", getBody(resp))
+		}
+
+		resp = authorized(confirm.URL, passwordJwt, map[string]interface{}{"code": "000000"})
+		assertStatus(t, 422, resp)
+		assertBody(t, "invalid two-factor code", resp)
+
+		now := time.Now()
+		resp = authorized(confirm.URL, passwordJwt, map[string]interface{}{"code": totpAt(t, enrolment.Secret, now)})
+		assertStatus(t, 200, resp)
+		var recovery mfaRecoveryCodes
+		if err := json.Unmarshal(resp.body, &recovery); err != nil || len(recovery.RecoveryCodes) != auth.RecoveryCodeCount {
+			t.Fatal("unexpected recovery codes", getBody(resp))
+		}
+		stored, _ := u.repository.Get(context.Background(), "test@mail.com")
+		for _, hash := range stored.MFA.RecoveryCodes {
+			if hash == recovery.RecoveryCodes[0] {
+				t.Error("recovery codes are stored in plain text")
+			}
+		}
+
+		req, err := http.NewRequest(http.MethodGet, me.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+passwordJwt)
+		resp = doRequest(req, err)
+		assertBody(t, "unauthorized", resp)
+
+		resp = doRequest(newJSONRequest(http.MethodPost, login.URL, prepareParams(t, credentials)))
+		assertStatus(t, 202, resp)
+		var challenge mfaChallenge
+		if err := json.Unmarshal(resp.body, &challenge); err != nil || !challenge.MFARequired {
+			t.Fatal("unexpected challenge", getBody(resp))
+		}
+
+		req, err = http.NewRequest(http.MethodGet, me.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+challenge.MFAToken)
+		resp = doRequest(req, err)
+		assertBody(t, "unauthorized", resp)
+
+		mfaParams := map[string]interface{}{"mfa_token": challenge.MFAToken, "code": recovery.RecoveryCodes[0]}
+		resp = doRequest(newJSONRequest(http.MethodPost, mfaLogin.URL, prepareParams(t, mfaParams)))
+		assertStatus(t, 200, resp)
+		mfaJwt := getBody(resp)
+
+		// the pending token is used up, even with a recovery code left
+		mfaParams["code"] = recovery.RecoveryCodes[1]
+		resp = doRequest(newJSONRequest(http.MethodPost, mfaLogin.URL, prepareParams(t, mfaParams)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "two-factor login expired, log in again", resp)
+
+		req, err = http.NewRequest(http.MethodGet, me.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+mfaJwt)
+		resp = doRequest(req, err)
+		assertStatus(t, 200, resp)
+
+		resp = authorized(disable.URL, mfaJwt, map[string]interface{}{"code": totpAt(t, enrolment.Secret, now.Add(30*time.Second))})
+		assertStatus(t, 200, resp)
+		assertBody(t, "two-factor authentication disabled", resp)
+		resp = doRequest(newJSONRequest(http.MethodPost, login.URL, prepareParams(t, credentials)))
+		assertStatus(t, 200, resp)
+	})
+	t.Run("wrong codes lock the second step", func(t *testing.T) {
+		doRequest := createRequester(t)
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		login := httptest.NewServer(wrapJwt(j, u.JWT))
+		mfaLogin := httptest.NewServer(wrapJwt(j, u.MFALogin))
+		defer login.Close()
+		defer mfaLogin.Close()
+
+		ctx := context.Background()
+		u.users.Register(ctx, service.RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		secret, _ := auth.NewTOTPSecret()
+		user, _ := u.repository.Get(ctx, "test@mail.com")
+		user.MFA = domain.MFAState{Secret: secret, Enabled: true}
+		u.repository.Update(ctx, user.Email, user)
+		challenge := func() string {
+			credentials := map[string]interface{}{"email": "test@mail.com", "password": "somepass"}
+			var c mfaChallenge
+			json.Unmarshal(doRequest(newJSONRequest(http.MethodPost, login.URL, prepareParams(t, credentials))).body, &c)
+			return c.MFAToken
+		}
+		mfaToken := challenge()
+
+		for i := 0; i < auth.MaxMFAAttempts; i++ {
+			resp := doRequest(newJSONRequest(http.MethodPost, mfaLogin.URL, prepareParams(t, map[string]interface{}{
+				"mfa_token": mfaToken, "code": "wrong",
+			})))
+			assertStatus(t, 422, resp)
+			assertBody(t, "invalid two-factor code", resp)
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, mfaLogin.URL, prepareParams(t, map[string]interface{}{
+			"mfa_token": mfaToken, "code": "wrong",
+		})))
+		assertStatus(t, 429, resp)
+		// a new password login doesn't reset the count
+		resp = doRequest(newJSONRequest(http.MethodPost, mfaLogin.URL, prepareParams(t, map[string]interface{}{
+			"mfa_token": challenge(), "code": totpAt(t, secret, time.Now()),
+		})))
+		assertStatus(t, 429, resp)
+		assertBody(t, "too many wrong two-factor codes, try again later", resp)
+	})
+	t.Run("admin routes require 2FA", func(t *testing.T) {
+		doRequest := createRequester(t)
+		os.Setenv("CAKE_ADMIN_EMAIL", "admin@mail.com")
+		os.Setenv("CAKE_ADMIN_PASSWORD", "adminadmin")
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(jwtAuthAdmin(j, u.repository, u.listUsersHandler))
+		defer ts.Close()
+		u.AddAdmin(context.Background())
+		admin, _ := u.repository.Get(context.Background(), "admin@mail.com")
+
+		passwordJwt, _ := j.GenearateJWT(admin)
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+passwordJwt)
+		resp := doRequest(req, err)
+		assertStatus(t, 422, resp)
+		assertBody(t, "two-factor authentication required", resp)
+
+		mfaJwt, _ := j.GenerateMFAJWT(admin)
+		req, err = http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+mfaJwt)
+		resp = doRequest(req, err)
+		assertStatus(t, 200, resp)
+	})
+}
+
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	code, err := auth.TOTPCode(secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
@@ -0,0 +1,149 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/storage"
+)
+
+// Middleware wraps a handler, it is the same type mux.Router.Use takes.
+type Middleware func(http.Handler) http.Handler
+
+// Chain is an ordered list of middlewares, the first one sees the
+// request first. Chains are immutable, Append returns a new one.
+type Chain []Middleware
+
+func NewChain(middlewares ...Middleware) Chain {
+	return append(Chain(nil), middlewares...)
+}
+
+func (c Chain) Append(middlewares ...Middleware) Chain {
+	result := make(Chain, 0, len(c)+len(middlewares))
+	result = append(result, c...)
+	return append(result, middlewares...)
+}
+
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+func (c Chain) ThenFunc(h http.HandlerFunc) http.Handler {
+	return c.Then(h)
+}
+
+// useChain attaches the chain to every route of a router or subrouter.
+func useChain(r *mux.Router, c Chain) {
+	for _, m := range c {
+		r.Use(mux.MiddlewareFunc(m))
+	}
+}
+
+// currentUser is the authenticated user of a request, handlers behind
+// RequireRole can always rely on it.
+func currentUser(r *http.Request) domain.User {
+	p, _ := auth.PrincipalFrom(r.Context())
+	return p.User
+}
+
+// endWith cancels the context of requests still running when ctx is done.
+func endWith(ctx context.Context) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			reqCtx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			go func() {
+				select {
+				case <-ctx.Done():
+					cancel()
+				case <-reqCtx.Done():
+				}
+			}()
+			h.ServeHTTP(rw, r.WithContext(reqCtx))
+		})
+	}
+}
+
+// Authenticate puts the principal of the request into the context and
+// rejects requests without valid credentials or from banned users.
+func Authenticate(j *auth.JWTService, users storage.UserRepository) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			p, err := j.Authenticate(r, users)
+			if err != nil {
+				handleError(err, rw)
+				return
+			}
+			if p.Cookie && !j.ValidCSRF(r, p.Session) {
+				handleError(errCSRF, rw)
+				return
+			}
+			if p.User.Banned(time.Now()) {
+				handleErrorCode(errors.New("you are banned! Reason: "+
+					p.User.BanHistory[len(p.User.BanHistory)-1].Reason),
+					http.StatusUnauthorized, rw)
+				return
+			}
+			h.ServeHTTP(rw, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// AuthenticateOptional works like Authenticate for requests with
+// credentials and lets anonymous requests through without a principal.
+func AuthenticateOptional(j *auth.JWTService, users storage.UserRepository) Middleware {
+	authenticate := Authenticate(j, users)
+	return func(h http.Handler) http.Handler {
+		authenticated := authenticate(h)
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			_, cookieErr := r.Cookie(auth.SessionCookieName)
+			if r.Header.Get("Authorization") == "" && cookieErr != nil {
+				h.ServeHTTP(rw, r)
+				return
+			}
+			authenticated.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// RequireSession lets through principals that logged in, API keys are
+// refused. It goes after RequireRole.
+func RequireSession(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		p, _ := auth.PrincipalFrom(r.Context())
+		if err := p.AuthorizeSession(); err != nil {
+			handleError(err, rw)
+			return
+		}
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// RequireRole lets through principals allowed to use routes of the role.
+// API keys are checked by scope, sessions on admin routes need 2FA. An
+// admin key can only be made from a session that passed 2FA.
+func RequireRole(role string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			p, ok := auth.PrincipalFrom(r.Context())
+			if !ok {
+				handleError(auth.ErrUnauthorized, rw)
+				return
+			}
+			if err := p.Authorize(role, r.Method); err != nil {
+				handleError(err, rw)
+				return
+			}
+			h.ServeHTTP(rw, r)
+		})
+	}
+}
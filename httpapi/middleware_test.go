@@ -0,0 +1,100 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"golang-api/auth"
+	"golang-api/domain"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Run("chain runs middlewares in order", func(t *testing.T) {
+		var calls []string
+		named := func(name string) Middleware {
+			return func(h http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					calls = append(calls, name)
+					h.ServeHTTP(w, r)
+				})
+			}
+		}
+		base := NewChain(named("first"))
+		chain := base.Append(named("second"), named("third"))
+		other := base.Append(named("other"))
+		chain.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "handler")
+		}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if strings.Join(calls, ",") != "first,second,third,handler" {
+			t.Error("unexpected order", calls)
+		}
+		if len(base) != 1 || len(other) != 2 {
+			t.Error("Append changed the base chain")
+		}
+	})
+	t.Run("useChain is attached per subrouter", func(t *testing.T) {
+		r := mux.NewRouter()
+		tagged := func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Group", "admin")
+				h.ServeHTTP(w, r)
+			})
+		}
+		admin := r.PathPrefix("/admin").Subrouter()
+		useChain(admin, NewChain(tagged))
+		ok := func(w http.ResponseWriter, r *http.Request) {}
+		admin.HandleFunc("/users", ok)
+		r.HandleFunc("/user/me", ok)
+
+		for path, group := range map[string]string{"/admin/users": "admin", "/user/me": ""} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Header().Get("X-Group") != group {
+				t.Errorf("%s: unexpected group %q", path, w.Header().Get("X-Group"))
+			}
+		}
+	})
+	t.Run("handlers read the principal from the context", func(t *testing.T) {
+		u := domain.User{Email: "test@mail.com", FavoriteCake: "cheesecake"}
+		r := httptest.NewRequest(http.MethodGet, "/user/me", nil)
+		r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{User: u}))
+		w := httptest.NewRecorder()
+		getMeHandler(w, r)
+		if w.Code != 200 || w.Body.String() != "cheesecaketest@mail.com" {
+			t.Error("unexpected response", w.Code, w.Body.String())
+		}
+	})
+	t.Run("RequireRole", func(t *testing.T) {
+		key := auth.APIKey{Scopes: []string{auth.ScopeUserRead}}
+		cases := []struct {
+			name      string
+			role      string
+			method    string
+			principal *auth.Principal
+			status    int
+		}{
+			{"no principal", "UserRole", http.MethodGet, nil, 422},
+			{"user on user route", "UserRole", http.MethodGet, &auth.Principal{User: domain.User{Role: "UserRole"}}, 200},
+			{"user on admin route", "AdminRole", http.MethodGet, &auth.Principal{User: domain.User{Role: "UserRole"}}, 422},
+			{"admin without 2FA", "AdminRole", http.MethodGet, &auth.Principal{User: domain.User{Role: "AdminRole"}}, 422},
+			{"admin with 2FA", "AdminRole", http.MethodGet, &auth.Principal{User: domain.User{Role: "AdminRole"}, Level: auth.LevelMFA}, 200},
+			{"read key reads", "UserRole", http.MethodGet, &auth.Principal{User: domain.User{Role: "UserRole"}, APIKey: &key}, 200},
+			{"read key writes", "UserRole", http.MethodPost, &auth.Principal{User: domain.User{Role: "UserRole"}, APIKey: &key}, 422},
+		}
+		for _, c := range cases {
+			r := httptest.NewRequest(c.method, "/", nil)
+			if c.principal != nil {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), *c.principal))
+			}
+			w := httptest.NewRecorder()
+			RequireRole(c.role)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			if w.Code != c.status {
+				t.Errorf("%s: expected %d, actual %d", c.name, c.status, w.Code)
+			}
+		}
+	})
+}
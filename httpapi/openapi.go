@@ -0,0 +1,322 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/graphqlapi"
+)
+
+const openAPIPath = "/openapi.json"
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema `json:"schemas"`
+	SecuritySchemes map[string]interface{}    `json:"securitySchemes"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string `json:"description"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *bool                     `json:"additionalProperties,omitempty"`
+}
+
+// schemaOf describes the JSON form of a params struct. Fields are required
+// unless their json tag has omitempty.
+func schemaOf(t reflect.Type) *openAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Struct:
+		closed := false
+		schema := &openAPISchema{
+			Type:                 "object",
+			Properties:           make(map[string]*openAPISchema),
+			AdditionalProperties: &closed,
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name, opts := domain.JSONFieldName(field)
+			if name == "-" {
+				continue
+			}
+			schema.Properties[name] = schemaOf(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	}
+	return &openAPISchema{}
+}
+
+// pathParameters returns the {variables} of a mux path template.
+func pathParameters(path string) []openAPIParameter {
+	var params []openAPIParameter
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+			if colon := strings.Index(name, ":"); colon >= 0 {
+				name = name[:colon]
+			}
+			params = append(params, openAPIParameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &openAPISchema{Type: "string"},
+			})
+		}
+	}
+	return params
+}
+
+func (rt route) operation(schemas map[string]*openAPISchema) *openAPIOperation {
+	op := &openAPIOperation{
+		Summary:    rt.Summary,
+		Deprecated: rt.Deprecated != nil,
+		Parameters: pathParameters(rt.Path),
+		Responses: map[string]openAPIResponse{
+			"422": {Description: "Invalid request"},
+		},
+	}
+	status := rt.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	op.Responses[fmt.Sprint(status)] = openAPIResponse{Description: http.StatusText(status)}
+	if rt.Session {
+		op.Security = []map[string][]string{{"bearer": {}}, {"cookie": {}}}
+	} else if rt.Auth != "" {
+		op.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}, {"cookie": {}}}
+	}
+	if rt.Auth != "" {
+		op.Responses["401"] = openAPIResponse{Description: "Banned user"}
+	}
+	for _, name := range rt.Query {
+		op.Parameters = append(op.Parameters, openAPIParameter{
+			Name:   name,
+			In:     "query",
+			Schema: &openAPISchema{Type: "string"},
+		})
+	}
+	if rt.Params != nil {
+		t := reflect.TypeOf(rt.Params)
+		schemas[t.Name()] = schemaOf(t)
+		op.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content: map[string]openAPIMediaType{
+				contentTypeJSON: {Schema: &openAPISchema{Ref: "#/components/schemas/" + t.Name()}},
+			},
+		}
+	}
+	return op
+}
+
+// newOpenAPIDocument describes the routes under every prefix they are
+// served at, prefixes here are the same as in newRouter.
+func newOpenAPIDocument(versions map[string][]route) *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Cake API", Version: "2"},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: make(map[string]*openAPISchema),
+			SecuritySchemes: map[string]interface{}{
+				"bearer": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				// "Authorization: ApiKey <key>", OpenAPI has no scheme for that prefix
+				"apiKey": map[string]string{"type": "apiKey", "in": "header", "name": "Authorization"},
+				// cookie sessions also need the X-CSRF-Token header for changes
+				"cookie": map[string]string{"type": "apiKey", "in": "cookie", "name": auth.SessionCookieName},
+			},
+		},
+	}
+	for prefix, routes := range versions {
+		for _, rt := range routes {
+			path := prefix + rt.Path
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]*openAPIOperation)
+			}
+			doc.Paths[path][strings.ToLower(rt.Method)] = rt.operation(doc.Components.Schemas)
+		}
+	}
+	doc.Paths[openAPIPath] = map[string]*openAPIOperation{
+		"get": {
+			Summary:   "This document",
+			Responses: map[string]openAPIResponse{"200": {Description: "OK"}},
+		},
+	}
+	// field errors are in the GraphQL response, credentials are optional
+	doc.Paths[graphqlPath] = map[string]*openAPIOperation{
+		"post": {
+			Summary:  "Run a GraphQL query or mutation",
+			Security: []map[string][]string{{}, {"bearer": {}}, {"apiKey": {}}, {"cookie": {}}},
+			RequestBody: &openAPIRequestBody{
+				Required: true,
+				Content:  map[string]openAPIMediaType{contentTypeJSON: {Schema: schemaOf(reflect.TypeOf(graphqlapi.Request{}))}},
+			},
+			Responses: map[string]openAPIResponse{
+				"200": {Description: "OK"},
+				"400": {Description: "No query"},
+				"422": {Description: "Invalid request"},
+			},
+		},
+	}
+	return doc
+}
+
+func (doc *openAPIDocument) handler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// validate checks a decoded JSON value against the schema.
+func (s *openAPISchema) validate(path string, value interface{}) error {
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok && path == "" {
+			return errors.New("request body should be an object")
+		}
+		if !ok {
+			return fmt.Errorf("%s should be an object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s is required", strings.TrimPrefix(path+"."+name, "."))
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			field := strings.TrimPrefix(path+"."+name, ".")
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s is not allowed", field)
+				}
+				continue
+			}
+			if err := prop.validate(field, obj[name]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s should be an array", path)
+		}
+		for i, item := range items {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s should be a string", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s should be a boolean", path)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (s.Type == "integer" && n != float64(int64(n))) {
+			return fmt.Errorf("%s should be a %s", path, s.Type)
+		}
+	}
+	return nil
+}
+
+// validateBody rejects requests whose body doesn't match the params of the route.
+func validateBody(schema *openAPISchema) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				handleError(errors.New("could not read request"), rw)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+			var value interface{}
+			if err := json.Unmarshal(body, &value); err != nil {
+				handleError(errors.New("could not read params"), rw)
+				return
+			}
+			if err := schema.validate("", value); err != nil {
+				handleError(err, rw)
+				return
+			}
+			h.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"golang-api/auth"
+)
+
+func TestOpenAPI(t *testing.T) {
+	doRequest := createRequester(t)
+
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.FailNow()
+	}
+	r := NewRouter(u, j, RouterConfig{LegacySunset: time.Now(), ValidateRequests: true})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp := doRequest(http.NewRequest(http.MethodGet, ts.URL+"/openapi.json", nil))
+	assertStatus(t, 200, resp)
+	doc := openAPIDocument{}
+	if err := json.Unmarshal(resp.body, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("every route is documented", func(t *testing.T) {
+		err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				return nil
+			}
+			methods, err := route.GetMethods()
+			if err != nil {
+				// path prefixes of subrouters have no methods
+				return nil
+			}
+			for _, method := range methods {
+				if doc.Paths[path][strings.ToLower(method)] == nil {
+					t.Errorf("%s %s is not documented", method, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("params are described", func(t *testing.T) {
+		op := doc.Paths["/v1/user/register"]["post"]
+		if op == nil || op.RequestBody == nil {
+			t.Fatal("register has no request body")
+		}
+		schema := doc.Components.Schemas["UserRegisterParams"]
+		if schema == nil || len(schema.Required) != 3 || schema.Properties["favorite_cake"].Type != "string" {
+			t.Error("unexpected register schema", schema)
+		}
+		if !doc.Paths["/admin/ban"]["post"].Deprecated {
+			t.Error("unversioned route is not deprecated")
+		}
+		if len(doc.Paths["/v2/admin/inspect"]["get"].Security) == 0 {
+			t.Error("admin route has no security")
+		}
+	})
+	t.Run("bodies are validated", func(t *testing.T) {
+		bodies := map[string]string{
+			`{"email":"test@mail.com","password":"somepass"}`:                           "favorite_cake is required",
+			`{"email":"test@mail.com","password":1,"favorite_cake":"cheesecake"}`:       "password should be a string",
+			`{"email":"test@mail.com","password":"somepass","favorite_cake":"a","x":1}`: "x is not allowed",
+			`[]`: "request body should be an object",
+		}
+		for body, expected := range bodies {
+			resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v1/user/register", strings.NewReader(body)))
+			assertStatus(t, 422, resp)
+			assertBody(t, expected, resp)
+		}
+	})
+}
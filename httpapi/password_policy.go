@@ -0,0 +1,18 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"golang-api/domain"
+)
+
+// passwordPolicyHandler shows the rules to clients, so they can check
+// passwords before sending them.
+func passwordPolicyHandler(p *domain.PasswordPolicy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, struct {
+			*domain.PasswordPolicy
+			CheckBreached bool `json:"check_breached"`
+		}{p, p.Breached != nil})
+	}
+}
@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/md5"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang-api/domain"
+)
+
+func TestPasswordReset(t *testing.T) {
+	t.Run("reset flow", func(t *testing.T) {
+		doRequest := createRequester(t)
+		mailer := &testMailer{}
+		u := newTestUserServiceWithMailer(mailer)
+		register := httptest.NewServer(http.HandlerFunc(u.Register))
+		reset := httptest.NewServer(http.HandlerFunc(u.resetPasswordHandler))
+		confirm := httptest.NewServer(http.HandlerFunc(u.confirmPasswordResetHandler))
+		defer register.Close()
+		defer reset.Close()
+		defer confirm.Close()
+
+		doRequest(newJSONRequest(http.MethodPost, register.URL, prepareParams(t, map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		})))
+
+		resp := doRequest(newJSONRequest(http.MethodPost, reset.URL, prepareParams(t, map[string]interface{}{
+			"email": "nobody@mail.com",
+		})))
+		assertStatus(t, 202, resp)
+		if mailer.to != "" {
+			t.Error("reset token sent for an unknown user")
+		}
+
+		resp = doRequest(newJSONRequest(http.MethodPost, reset.URL, prepareParams(t, map[string]interface{}{
+			"email": "Test@mail.com",
+		})))
+		assertStatus(t, 202, resp)
+		token := mailer.lastToken()
+
+		weak := map[string]interface{}{"token": token, "password": "cheesecake1"}
+		resp = doRequest(newJSONRequest(http.MethodPost, confirm.URL, prepareParams(t, weak)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "Password should not contain your email or favorite cake", resp)
+
+		strong := map[string]interface{}{"token": token, "password": "anotherpass"}
+		resp = doRequest(newJSONRequest(http.MethodPost, confirm.URL, prepareParams(t, strong)))
+		assertStatus(t, 200, resp)
+		user, _ := u.repository.Get(context.Background(), "test@mail.com")
+		if user.PasswordDigest != string(md5.New().Sum([]byte("anotherpass"))) {
+			t.Error("password was not reset")
+		}
+
+		resp = doRequest(newJSONRequest(http.MethodPost, confirm.URL, prepareParams(t, strong)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "invalid reset token", resp)
+	})
+	t.Run("policy document", func(t *testing.T) {
+		doRequest := createRequester(t)
+		ts := httptest.NewServer(passwordPolicyHandler(domain.DefaultPasswordPolicy()))
+		defer ts.Close()
+		resp := doRequest(http.NewRequest(http.MethodGet, ts.URL, nil))
+		assertStatus(t, 200, resp)
+		if !strings.Contains(getBody(resp), `"min_length":8`) || !strings.Contains(getBody(resp), `"check_breached":false`) {
+			t.Error("unexpected policy", getBody(resp))
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"net/http"
+)
+
+type PasswordResetConfirmParams struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+func (uServ UserService) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	params := &EmailParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	email, err := uServ.users.RequestPasswordReset(r.Context(), params.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("if the user exists, a reset token was sent to " + email))
+}
+
+func (uServ UserService) confirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	params := &PasswordResetConfirmParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := uServ.users.ResetPassword(r.Context(), params.Token, params.Password); err != nil {
+		handleError(localizeError(r, err), w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("password updated"))
+}
@@ -0,0 +1,451 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"golang-api/auth"
+	"golang-api/graphqlapi"
+	"golang-api/webhooks"
+)
+
+// defaultLegacySunset is when the unversioned routes stop working
+// unless CAKE_LEGACY_SUNSET says otherwise.
+const defaultLegacySunset = "2027-06-01"
+
+type route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	// The fields below are used for the OpenAPI document.
+	Summary string
+	// Params is the type of the JSON body, nil for requests without body.
+	Params interface{}
+	Query  []string
+	// Auth is the role the route requires, empty for public routes.
+	Auth string
+	// Status is the success status code, 200 if not set.
+	Status     int
+	Deprecated *deprecation
+	// Sensitive routes carry credentials like passwords, tokens and keys
+	// in their bodies, the log leaves the bodies out.
+	Sensitive bool
+	// Session routes manage credentials or the account, API keys can't
+	// call them.
+	Session bool
+	// Stream routes keep the response open, they end when the
+	// RouterConfig.Shutdown context is done.
+	Stream bool
+}
+
+type RouterConfig struct {
+	// LegacySunset is when the unversioned routes stop working.
+	LegacySunset time.Time
+	// ValidateRequests checks request bodies against the OpenAPI
+	// document before they get to the handlers.
+	ValidateRequests bool
+	// Headers are the CORS and security header policies,
+	// DefaultHeaderPolicies are used when it is nil.
+	Headers HeaderPolicies
+	// GraphQLLimits are the query limits of /graphql, the defaults are
+	// used when it is zero.
+	GraphQLLimits graphqlapi.Limits
+	// Webhooks serves the webhook admin routes. The default keeps the
+	// subscriptions in memory and delivers nothing, the server passes
+	// the dispatcher it runs.
+	Webhooks *webhooks.Dispatcher
+	// Shutdown ends the open event streams when it is done, so they don't
+	// hold up a graceful shutdown. Without it they end with their clients.
+	Shutdown context.Context
+}
+
+// deprecation marks a route that still works but will be removed at Sunset.
+// Successor is the path clients should move to.
+type deprecation struct {
+	Sunset    time.Time
+	Successor string
+}
+
+func (d *deprecation) middleware(method, path string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Deprecation", "true")
+			rw.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			if d.Successor != "" {
+				rw.Header().Set("Link", "<"+d.Successor+`>; rel="successor-version"`)
+			}
+			log.Printf("DEPRECATED %s %s called by %s (%s)", method, path, r.RemoteAddr, r.UserAgent())
+			h.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// apiRoutes is the route table of the API. Every version is built from it,
+// paths are relative to the version prefix.
+func apiRoutes(userService *UserService, jwtService *auth.JWTService, dispatcher *webhooks.Dispatcher) []route {
+	authHandlers := authHandlers{jwtService, userService.repository}
+	webhookHandlers := webhookHandlers{dispatcher}
+	return []route{
+		{
+			Method: http.MethodPost, Path: "/admin/ban", Auth: "AdminRole",
+			Handler: userService.banUserHandler,
+			Summary: "Ban a user", Params: UserBanParams{},
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/unban", Auth: "AdminRole",
+			Handler: userService.unbanUserHandler,
+			Summary: "Unban a user", Params: UserUnbanParams{},
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/delete", Auth: "AdminRole",
+			Handler: wrapJwt(jwtService, userService.deleteUserHandler),
+			Summary: "Delete a user, it can be restored until it is purged", Params: EmailParams{},
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/restore", Auth: "AdminRole",
+			Handler: userService.restoreUserHandler,
+			Summary: "Restore a deleted user", Params: EmailParams{},
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/purge", Auth: "AdminRole",
+			Handler: wrapJwt(jwtService, userService.purgeUserHandler),
+			Summary: "Remove a deleted user for good", Params: EmailParams{},
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/inspect", Auth: "AdminRole",
+			Handler: userService.inspectHandler,
+			Summary: "Show a user with the ban history", Query: []string{"email"},
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/users", Auth: "AdminRole",
+			Handler: userService.listUsersHandler,
+			Summary: "List users",
+			Query:   []string{"role", "banned", "deleted", "email_prefix", "email_contains", "favorite_cake", "cursor", "limit"},
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/events", Auth: "AdminRole",
+			Handler: wrapJwt(jwtService, userService.adminEventsHandler), Stream: true,
+			Summary: "Stream account and moderation events (Server-Sent Events)",
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/webhooks", Auth: "AdminRole",
+			Handler: webhookHandlers.createWebhookHandler,
+			Summary: "Subscribe a URL to events", Params: WebhookParams{}, Status: http.StatusCreated,
+			Sensitive: true,
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/webhooks", Auth: "AdminRole",
+			Handler: webhookHandlers.listWebhooksHandler,
+			Summary: "List webhook subscriptions",
+		},
+		{
+			Method: http.MethodDelete, Path: "/admin/webhooks/{id}", Auth: "AdminRole",
+			Handler: webhookHandlers.deleteWebhookHandler,
+			Summary: "Delete a webhook subscription",
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/webhooks/{id}/deliveries", Auth: "AdminRole",
+			Handler: webhookHandlers.listDeliveriesHandler,
+			Summary: "Show the delivery log of a webhook subscription",
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/webhooks/deliveries/{id}/redeliver", Auth: "AdminRole",
+			Handler: webhookHandlers.redeliverHandler,
+			Summary: "Send a webhook delivery again",
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/logout", Auth: "AdminRole",
+			Handler: authHandlers.logoutUserHandler,
+			Summary: "End every session of a user", Params: EmailParams{},
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/api-keys", Auth: "AdminRole",
+			Handler: authHandlers.adminCreateAPIKeyHandler,
+			Summary: "Create an API key for any user", Params: AdminAPIKeyParams{}, Status: http.StatusCreated,
+			Sensitive: true,
+			Session:   true,
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/api-keys", Auth: "AdminRole",
+			Handler: authHandlers.adminListAPIKeysHandler,
+			Summary: "List API keys", Query: []string{"owner"},
+		},
+		{
+			Method: http.MethodDelete, Path: "/admin/api-keys/{id}", Auth: "AdminRole",
+			Handler: authHandlers.adminRevokeAPIKeyHandler,
+			Summary: "Revoke any API key",
+		},
+		{
+			Method: http.MethodPost, Path: "/admin/service-accounts", Auth: "AdminRole",
+			Handler: userService.createServiceAccountHandler,
+			Summary: "Create a service account", Params: ServiceAccountParams{}, Status: http.StatusCreated,
+			Sensitive: true,
+			Session:   true,
+		},
+
+		{
+			Method: http.MethodGet, Path: "/user/me", Auth: "UserRole",
+			Handler: getMeHandler,
+			Summary: "Show the current user",
+		},
+		{
+			Method: http.MethodPost, Path: "/user/favorite_cake", Auth: "UserRole",
+			Handler: userService.updateCakeHandler,
+			Summary: "Change the favorite cake", Params: ProfileParams{},
+		},
+		{
+			Method: http.MethodPost, Path: "/user/email", Auth: "UserRole",
+			Handler: userService.updateEmailHandler,
+			Summary: "Request an email change", Params: EmailParams{}, Status: http.StatusAccepted,
+			Session: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/email/confirm",
+			Handler: userService.confirmEmailHandler,
+			Summary: "Confirm an email change", Params: EmailConfirmParams{},
+			Sensitive: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/password", Auth: "UserRole",
+			Handler: userService.updatePasswordHandler,
+			Summary: "Change the password", Params: PasswordParams{},
+			Sensitive: true,
+			Session:   true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/password/reset",
+			Handler: userService.resetPasswordHandler,
+			Summary: "Mail a password reset token", Params: EmailParams{}, Status: http.StatusAccepted,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/password/reset/confirm",
+			Handler: userService.confirmPasswordResetHandler,
+			Summary: "Set a new password with a reset token", Params: PasswordResetConfirmParams{},
+			Sensitive: true,
+		},
+		{
+			Method: http.MethodGet, Path: "/user/sessions", Auth: "UserRole",
+			Handler: authHandlers.listSessionsHandler,
+			Summary: "List your sessions",
+		},
+		{
+			Method: http.MethodDelete, Path: "/user/sessions/{id}", Auth: "UserRole",
+			Handler: authHandlers.deleteSessionHandler,
+			Summary: "Log a session out",
+			Session: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/logout", Auth: "UserRole",
+			Handler: authHandlers.logoutHandler,
+			Summary: "End the current session and clear the session cookies",
+		},
+		{
+			Method: http.MethodPost, Path: "/user/api-keys", Auth: "UserRole",
+			Handler: authHandlers.createAPIKeyHandler,
+			Summary: "Create an API key", Params: APIKeyParams{}, Status: http.StatusCreated,
+			Sensitive: true,
+			Session:   true,
+		},
+		{
+			Method: http.MethodGet, Path: "/user/api-keys", Auth: "UserRole",
+			Handler: authHandlers.listAPIKeysHandler,
+			Summary: "List your API keys",
+		},
+		{
+			Method: http.MethodDelete, Path: "/user/api-keys/{id}", Auth: "UserRole",
+			Handler: authHandlers.revokeAPIKeyHandler,
+			Summary: "Revoke an API key",
+			Session: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/mfa/enroll", Auth: "UserRole",
+			Handler:   userService.enrollMFAHandler,
+			Summary:   "Start two-factor enrolment and get the TOTP secret",
+			Sensitive: true,
+			Session:   true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/mfa/confirm", Auth: "UserRole",
+			Handler: userService.confirmMFAHandler,
+			Summary: "Enable two-factor authentication and get recovery codes", Params: MFACodeParams{},
+			Sensitive: true,
+			Session:   true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/mfa/disable", Auth: "UserRole",
+			Handler: userService.disableMFAHandler,
+			Summary: "Disable two-factor authentication", Params: MFACodeParams{},
+			Sensitive: true,
+			Session:   true,
+		},
+		{
+			Method: http.MethodGet, Path: "/user/events", Auth: "UserRole",
+			Handler: wrapJwt(jwtService, userService.userEventsHandler), Stream: true,
+			Summary: "Stream bans and password changes of the account (Server-Sent Events)",
+		},
+		{
+			Method: http.MethodGet, Path: "/user/export", Auth: "UserRole",
+			Handler:   wrapJwt(jwtService, userService.exportHandler),
+			Summary:   "Download everything held about the account",
+			Sensitive: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/delete", Auth: "UserRole",
+			Handler: userService.deleteAccountHandler,
+			Summary: "Delete the account after a grace period", Params: DeleteAccountParams{}, Status: http.StatusAccepted,
+			Sensitive: true,
+			Session:   true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/delete/cancel", Auth: "UserRole",
+			Handler: userService.cancelDeletionHandler,
+			Summary: "Cancel the deletion of the account",
+			Session: true,
+		},
+		{
+			Method: http.MethodGet, Path: "/password-policy",
+			Handler: passwordPolicyHandler(userService.passwordPolicy),
+			Summary: "Show the password rules",
+		},
+
+		{
+			Method: http.MethodGet, Path: "/cake", Auth: "UserRole",
+			Handler: getCakeHandler,
+			Summary: "Show the favorite cake",
+		},
+		{
+			Method: http.MethodPost, Path: "/user/register",
+			Handler: userService.Register,
+			Summary: "Register a user", Params: UserRegisterParams{}, Status: http.StatusCreated,
+			Sensitive: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/jwt",
+			Handler: wrapJwt(jwtService, userService.JWT),
+			Summary: "Log in and get a JWT", Params: JWTParams{},
+			Sensitive: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/user/jwt/mfa",
+			Handler: wrapJwt(jwtService, userService.MFALogin),
+			Summary: "Finish a two-factor login", Params: MFALoginParams{},
+			Sensitive: true,
+		},
+	}
+}
+
+// registerRoutes builds the chain of every route from its table entry:
+// deprecation headers, logging, authentication and the role check, then
+// the body checks. authenticate puts the principal into the context.
+func registerRoutes(r *mux.Router, routes []route, cfg RouterConfig, authenticate Middleware) {
+	for _, rt := range routes {
+		var chain Chain
+		if rt.Deprecated != nil {
+			chain = chain.Append(rt.Deprecated.middleware(rt.Method, rt.Path))
+		}
+		if rt.Sensitive {
+			chain = chain.Append(logRequestRedacted)
+		} else {
+			chain = chain.Append(logRequest)
+		}
+		if rt.Auth != "" {
+			chain = chain.Append(authenticate, RequireRole(rt.Auth))
+		}
+		if rt.Session {
+			chain = chain.Append(RequireSession)
+		}
+		if rt.Stream && cfg.Shutdown != nil {
+			chain = chain.Append(endWith(cfg.Shutdown))
+		}
+		if rt.Params != nil {
+			chain = chain.Append(requireJSON)
+		}
+		if cfg.ValidateRequests && rt.Params != nil {
+			chain = chain.Append(validateBody(schemaOf(reflect.TypeOf(rt.Params))))
+		}
+		r.Handle(rt.Path, chain.Then(rt.Handler)).Methods(rt.Method)
+	}
+}
+
+// deprecate returns a copy of the routes marked as deprecated in favour of
+// the same path under successorPrefix.
+func deprecate(routes []route, sunset time.Time, successorPrefix string) []route {
+	result := make([]route, 0, len(routes))
+	for _, rt := range routes {
+		rt.Deprecated = &deprecation{Sunset: sunset, Successor: successorPrefix + rt.Path}
+		result = append(result, rt)
+	}
+	return result
+}
+
+// preferJSON makes JSON the default format of v2 for clients that
+// accept anything. Clients can still ask for text/plain explicitly.
+func preferJSON(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		accept := strings.TrimSpace(r.Header.Get("Accept"))
+		if accept == "" || accept == "*/*" {
+			r.Header.Set("Accept", contentTypeJSON)
+		}
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// NewRouter serves the API under /v1 and /v2. v1 is frozen, new response
+// formats go to v2 only. The unversioned routes are v1 kept for old
+// clients until the sunset. GraphQL is served unversioned at /graphql.
+func NewRouter(userService *UserService, jwtService *auth.JWTService, cfg RouterConfig) *mux.Router {
+	r := mux.NewRouter()
+	if cfg.Headers == nil {
+		cfg.Headers = DefaultHeaderPolicies()
+	}
+	useChain(r, NewChain(cfg.Headers.middleware))
+	r.MethodNotAllowedHandler = http.HandlerFunc(cfg.Headers.methodNotAllowed)
+	dispatcher := cfg.Webhooks
+	if dispatcher == nil {
+		dispatcher = webhooks.NewDispatcher(webhooks.NewInMemoryStore(), nil, webhooks.DefaultRetryPolicy())
+	}
+	routes := apiRoutes(userService, jwtService, dispatcher)
+	legacy := deprecate(routes, cfg.LegacySunset, "/v1")
+	authenticate := Authenticate(jwtService, userService.repository)
+
+	registerRoutes(r.PathPrefix("/v1").Subrouter(), routes, cfg, authenticate)
+
+	v2 := r.PathPrefix("/v2").Subrouter()
+	useChain(v2, NewChain(preferJSON))
+	registerRoutes(v2, routes, cfg, authenticate)
+
+	registerRoutes(r, legacy, cfg, authenticate)
+
+	doc := newOpenAPIDocument(map[string][]route{"/v1": routes, "/v2": routes, "": legacy})
+	r.HandleFunc(openAPIPath, doc.handler).Methods(http.MethodGet)
+
+	limits := cfg.GraphQLLimits
+	if limits == (graphqlapi.Limits{}) {
+		limits = graphqlapi.DefaultLimits()
+	}
+	schema, err := graphqlapi.NewSchema(userService.users, limits)
+	if err != nil {
+		// the schema is static, this only fails after a broken change to it
+		panic(err)
+	}
+	graphql := NewChain(logRequestRedacted, AuthenticateOptional(jwtService, userService.repository))
+	r.Handle(graphqlPath, graphql.Then(graphqlHandler(schema))).Methods(http.MethodPost)
+	return r
+}
+
+// LegacySunsetFromEnv reads the sunset date of unversioned routes from
+// CAKE_LEGACY_SUNSET in YYYY-MM-DD format.
+func LegacySunsetFromEnv() (time.Time, error) {
+	value := os.Getenv("CAKE_LEGACY_SUNSET")
+	if value == "" {
+		value = defaultLegacySunset
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+)
+
+func TestRoutes_versions(t *testing.T) {
+	doRequest := createRequester(t)
+
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.FailNow()
+	}
+	sunset := time.Date(2027, time.June, 1, 0, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: sunset}))
+	defer ts.Close()
+
+	params := map[string]interface{}{
+		"email":         "test@mail.com",
+		"password":      "somepass",
+		"favorite_cake": "cheesecake",
+	}
+	resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v1/user/register", prepareParams(t, params)))
+	assertStatus(t, 201, resp)
+	jwtParams := map[string]interface{}{
+		"email":    "test@mail.com",
+		"password": "somepass",
+	}
+	token := getBody(doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v2/user/jwt", prepareParams(t, jwtParams))))
+
+	getMe := func(path string) (parsedResponse, http.Header) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return parsedResponse{res.StatusCode, body}, res.Header
+	}
+
+	t.Run("v1 is frozen", func(t *testing.T) {
+		resp, header := getMe("/v1/user/me")
+		assertStatus(t, 200, resp)
+		assertBody(t, "cheesecaketest@mail.com", resp)
+		if header.Get("Deprecation") != "" {
+			t.Error("v1 is not deprecated yet")
+		}
+	})
+	t.Run("v2 answers json", func(t *testing.T) {
+		resp, header := getMe("/v2/user/me")
+		assertStatus(t, 200, resp)
+		if header.Get("Content-Type") != "application/json" {
+			t.Error("unexpected content type", header.Get("Content-Type"))
+		}
+	})
+	t.Run("unversioned routes are deprecated", func(t *testing.T) {
+		resp, header := getMe("/user/me")
+		assertStatus(t, 200, resp)
+		assertBody(t, "cheesecaketest@mail.com", resp)
+		if header.Get("Deprecation") != "true" {
+			t.Error("no Deprecation header")
+		}
+		if header.Get("Sunset") != "Tue, 01 Jun 2027 00:00:00 GMT" {
+			t.Error("unexpected Sunset header", header.Get("Sunset"))
+		}
+		if header.Get("Link") != `</v1/user/me>; rel="successor-version"` {
+			t.Error("unexpected Link header", header.Get("Link"))
+		}
+	})
+
+	t.Run("graphql", func(t *testing.T) {
+		query := map[string]interface{}{"query": "{ viewer { email } }"}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/graphql", prepareParams(t, query)))
+		assertStatus(t, 200, resp)
+		assertBody(t, `{"data":{"viewer":null},"errors":[{"message":"unauthorized","locations":[{"line":1,"column":3}],"path":["viewer"]}]}`+"\n", resp)
+
+		req, err := newJSONRequest(http.MethodPost, ts.URL+"/graphql", prepareParams(t, query))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp = doRequest(req, err)
+		assertStatus(t, 200, resp)
+		assertBody(t, `{"data":{"viewer":{"email":"test@mail.com"}}}`+"\n", resp)
+
+		req, err = newJSONRequest(http.MethodPost, ts.URL+"/graphql", prepareParams(t, query))
+		req.Header.Set("Authorization", "Bearer forged")
+		resp = doRequest(req, err)
+		assertStatus(t, 422, resp)
+	})
+}
@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"golang-api/auth"
+	"golang-api/domain"
+)
+
+type SessionView struct {
+	ID         string `json:"id"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	IP         string `json:"ip,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	MFA        bool   `json:"mfa"`
+	Current    bool   `json:"current"`
+}
+
+func newSessionView(s auth.Session, current string) SessionView {
+	return SessionView{
+		ID:         s.ID,
+		CreatedAt:  s.Created.UTC().Format(time.RFC3339),
+		LastSeenAt: s.LastSeen.UTC().Format(time.RFC3339),
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+		MFA:        s.Level >= auth.LevelMFA,
+		Current:    s.ID == current,
+	}
+}
+
+func (j authHandlers) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	p, _ := auth.PrincipalFrom(r.Context())
+	sessions, err := j.Sessions().List(r.Context(), p.User.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	views := make([]SessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, newSessionView(session, p.Session))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (j authHandlers) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	session, err := j.Sessions().Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil || session.Email != u.Email {
+		handleErrorCode(auth.ErrSessionNotFound, http.StatusNotFound, w)
+		return
+	}
+	if err := j.Sessions().Delete(r.Context(), session.ID); err != nil {
+		handleError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("session deleted"))
+}
+
+// logoutUserHandler lets admins end every session of a user.
+func (j authHandlers) logoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	params := &EmailParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	email, err := domain.NormalizeEmail(params.Email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	if _, err := j.users.Get(r.Context(), email); err != nil {
+		handleError(err, w)
+		return
+	}
+	deleted, err := j.Sessions().DeleteAll(r.Context(), email)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Deleted int `json:"deleted"`
+	}{deleted})
+}
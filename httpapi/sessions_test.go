@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+)
+
+func TestSessions(t *testing.T) {
+	doRequest := createRequester(t)
+	os.Setenv("CAKE_ADMIN_EMAIL", "admin@mail.com")
+	os.Setenv("CAKE_ADMIN_PASSWORD", "adminadmin")
+
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.FailNow()
+	}
+	ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().AddDate(1, 0, 0)}))
+	defer ts.Close()
+
+	doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v2/user/register", prepareParams(t, map[string]interface{}{
+		"email":         "test@mail.com",
+		"password":      "somepass",
+		"favorite_cake": "cheesecake",
+	})))
+	login := func(userAgent string) string {
+		req, err := newJSONRequest(http.MethodPost, ts.URL+"/v2/user/jwt", prepareParams(t, map[string]interface{}{
+			"email":    "test@mail.com",
+			"password": "somepass",
+		}))
+		req.Header.Set("User-Agent", userAgent)
+		return getBody(doRequest(req, err))
+	}
+	call := func(method, path, token string) parsedResponse {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return doRequest(req, err)
+	}
+	listSessions := func(token string) []SessionView {
+		resp := call(http.MethodGet, "/v2/user/sessions", token)
+		assertStatus(t, 200, resp)
+		var sessions []SessionView
+		if err := json.Unmarshal(resp.body, &sessions); err != nil {
+			t.Fatal(err)
+		}
+		return sessions
+	}
+
+	t.Run("list and revoke", func(t *testing.T) {
+		laptop := login("laptop")
+		phone := login("phone")
+
+		sessions := listSessions(laptop)
+		if len(sessions) != 2 {
+			t.Fatal("unexpected sessions", sessions)
+		}
+		var phoneID string
+		for _, s := range sessions {
+			if s.UserAgent == "laptop" && !s.Current || s.UserAgent == "phone" && s.Current || s.IP != "127.0.0.1" {
+				t.Error("unexpected session", s)
+			}
+			if s.UserAgent == "phone" {
+				phoneID = s.ID
+			}
+		}
+
+		resp := call(http.MethodDelete, "/v2/user/sessions/"+phoneID, laptop)
+		assertStatus(t, 200, resp)
+		assertBody(t, "unauthorized", call(http.MethodGet, "/v2/user/me", phone))
+		assertStatus(t, 200, call(http.MethodGet, "/v2/user/me", laptop))
+	})
+	t.Run("sessions of others are hidden", func(t *testing.T) {
+		u.AddAdmin(context.Background())
+		admin, _ := u.repository.Get(context.Background(), "admin@mail.com")
+		adminJwt, _ := j.GenerateMFAJWT(admin)
+		adminSessions := listSessions(adminJwt)
+
+		resp := call(http.MethodDelete, "/v2/user/sessions/"+adminSessions[0].ID, login("laptop"))
+		assertStatus(t, 404, resp)
+	})
+	t.Run("admin force logout", func(t *testing.T) {
+		token := login("laptop")
+		admin, _ := u.repository.Get(context.Background(), "admin@mail.com")
+		adminJwt, _ := j.GenerateMFAJWT(admin)
+
+		req, err := newJSONRequest(http.MethodPost, ts.URL+"/v2/admin/logout", prepareParams(t, map[string]interface{}{
+			"email": "test@mail.com",
+		}))
+		req.Header.Set("Authorization", "Bearer "+adminJwt)
+		resp := doRequest(req, err)
+		assertStatus(t, 200, resp)
+		assertBody(t, "unauthorized", call(http.MethodGet, "/v2/user/me", token))
+		assertStatus(t, 200, call(http.MethodGet, "/v2/user/me", adminJwt))
+	})
+}
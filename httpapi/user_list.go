@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"golang-api/storage"
+)
+
+type userListResponse struct {
+	Users      []UserView `json:"users"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+func (uServ UserService) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := storage.UserFilter{
+		Role:          query.Get("role"),
+		EmailPrefix:   query.Get("email_prefix"),
+		EmailContains: query.Get("email_contains"),
+		FavoriteCake:  query.Get("favorite_cake"),
+	}
+	if banned := query.Get("banned"); banned != "" {
+		b, err := strconv.ParseBool(banned)
+		if err != nil {
+			handleError(errors.New("banned should be true or false"), w)
+			return
+		}
+		filter.Banned = &b
+	}
+	if deleted := query.Get("deleted"); deleted != "" {
+		d, err := strconv.ParseBool(deleted)
+		if err != nil {
+			handleError(errors.New("deleted should be true or false"), w)
+			return
+		}
+		filter.Deleted = d
+	}
+	page := storage.Page{Cursor: query.Get("cursor")}
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			handleError(errors.New("limit should be a positive number"), w)
+			return
+		}
+		page.Limit = l
+	}
+
+	result, err := uServ.repository.List(r.Context(), filter, page)
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	resp := userListResponse{
+		Users:      make([]UserView, 0, len(result.Users)),
+		NextCursor: result.NextCursor,
+	}
+	for _, u := range result.Users {
+		resp.Users = append(resp.Users, newUserView(u, false))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,657 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/service"
+	"golang-api/storage"
+)
+
+type parsedResponse struct {
+	status int
+	body   []byte
+}
+
+func createRequester(t *testing.T) func(req *http.Request, err error) parsedResponse {
+	return func(req *http.Request, err error) parsedResponse {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return parsedResponse{}
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return parsedResponse{}
+		}
+		resp, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return parsedResponse{}
+		}
+		return parsedResponse{res.StatusCode, resp}
+	}
+}
+func prepareParams(t *testing.T, params map[string]interface{}) io.
+	Reader {
+	body, err := json.Marshal(params)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	return bytes.NewBuffer(body)
+}
+
+func newJSONRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, err
+}
+
+type testMailer struct {
+	to   string
+	body string
+}
+
+func (m *testMailer) Send(to, subject, body string) error {
+	m.to = to
+	m.body = body
+	return nil
+}
+func (m *testMailer) lastToken() string {
+	fields := strings.Fields(m.body)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// testKeyPaths returns key file paths in a per-test directory so that
+// NewJWTService generates a fresh key pair instead of touching the repo.
+func testKeyPaths(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	return filepath.Join(dir, "priv.rsa"), filepath.Join(dir, "pub.rsa")
+}
+
+func jwtAuth(j *auth.JWTService, users storage.UserRepository, h http.HandlerFunc) http.Handler {
+	return NewChain(Authenticate(j, users), RequireRole("UserRole")).ThenFunc(h)
+}
+
+func jwtAuthAdmin(j *auth.JWTService, users storage.UserRepository, h http.HandlerFunc) http.Handler {
+	return NewChain(Authenticate(j, users), RequireRole("AdminRole")).ThenFunc(h)
+}
+
+func newTestUserService() *UserService {
+	return newTestUserServiceWithMailer(&testMailer{})
+}
+
+func newTestUserServiceWithMailer(mailer service.Mailer) *UserService {
+	return NewUserService(service.NewUsers(storage.FromLegacy(storage.NewInMemoryUserStorage()), mailer, domain.DefaultPasswordPolicy()))
+}
+
+func assertStatus(t *testing.T, expected int, r parsedResponse) {
+	if r.status != expected {
+		t.Errorf("Unexpected response status. Expected: %d,actual: %d", expected, r.status)
+	}
+}
+func assertBody(t *testing.T, expected string, r parsedResponse) {
+	actual := string(r.body)
+	if actual != expected {
+		t.Errorf("Unexpected response body. Expected: %s,actual: %s", expected, actual)
+	}
+}
+func getBody(r parsedResponse) string {
+	a := string(r.body)
+	return a
+}
+func TestUsers_JWT(t *testing.T) {
+	doRequest := createRequester(t)
+	t.Run("user does not exist", func(t *testing.T) {
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(wrapJwt(j, u.JWT)))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":    "test@mail.com",
+			"password": "somepass",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "invalid login params", resp)
+	})
+	t.Run("wrong password", func(t *testing.T) {
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(wrapJwt(j, u.JWT)))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		params2 := map[string]interface{}{
+			"email":    "test@mail.com",
+			"password": "someAnotherpass",
+		}
+
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/jwt", prepareParams(t, params2)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "invalid login params", resp)
+	})
+	t.Run("newjwtservice error", func(t *testing.T) {
+		_, err := auth.NewJWTService("", "pjnskfg")
+		if err == nil {
+			t.Error("pub and priv keys are okay")
+		}
+	})
+
+	t.Run("user register", func(t *testing.T) {
+		u := newTestUserService()
+		_, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+		assertStatus(t, 201, resp)
+		assertBody(t, "registered", resp)
+	})
+
+	t.Run("user cake unauthorized", func(t *testing.T) {
+		u := newTestUserService()
+		users := storage.FromLegacy(storage.NewInMemoryUserStorage())
+
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(jwtAuth(j, users, getCakeHandler))
+
+		ts3 := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "",
+		}
+		doRequest(newJSONRequest(http.MethodPost, ts3.URL+"/user/register", prepareParams(t, params)))
+
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/cake", prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "unauthorized", resp)
+	})
+	t.Run("cheesecake", func(t *testing.T) {
+		u := newTestUserService()
+		//users := NewInMemoryUserStorage()
+
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(jwtAuth(j, u.repository, getCakeHandler))
+		ts2 := httptest.NewServer(http.HandlerFunc(wrapJwt(j, u.JWT)))
+		ts3 := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		params2 := map[string]interface{}{
+			"email":    "test@mail.com",
+			"password": "somepass",
+		}
+		doRequest(newJSONRequest(http.MethodPost, ts3.URL+"/user/register", prepareParams(t, params)))
+		temp := doRequest(newJSONRequest(http.MethodPost, ts2.URL, prepareParams(t, params2)))
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Add("Authorization", "Bearer "+string(getBody(temp)))
+		resp := doRequest(req, err)
+
+		assertStatus(t, 200, resp)
+		assertBody(t, "cheesecake", resp)
+	})
+	t.Run("emailHandler", func(t *testing.T) {
+		u := newTestUserService()
+		//users := NewInMemoryUserStorage()
+
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(jwtAuth(j, u.repository, getEmailHandler))
+		ts2 := httptest.NewServer(http.HandlerFunc(wrapJwt(j, u.JWT)))
+		ts3 := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		params2 := map[string]interface{}{
+			"email":    "test@mail.com",
+			"password": "somepass",
+		}
+		doRequest(newJSONRequest(http.MethodPost, ts3.URL+"/user/register", prepareParams(t, params)))
+		temp := doRequest(newJSONRequest(http.MethodPost, ts2.URL, prepareParams(t, params2)))
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Add("Authorization", "Bearer "+string(getBody(temp)))
+		resp := doRequest(req, err)
+
+		assertStatus(t, 200, resp)
+		assertBody(t, "test@mail.com", resp)
+	})
+	t.Run("udate cakeHandler", func(t *testing.T) {
+		u := newTestUserService()
+		//users := NewInMemoryUserStorage()
+
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+
+		ts3 := httptest.NewServer(jwtAuth(j, u.repository, u.updateCakeHandler))
+
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		params2 := map[string]interface{}{"favorite_cake": "newcakemufin"}
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+
+		Useruser, _ := u.repository.Get(context.Background(), "test@mail.com")
+		adminJwt, _ := j.GenearateJWT(Useruser)
+
+		req, err := newJSONRequest(http.MethodGet, ts3.URL, prepareParams(t, params2))
+		req.Header.Add("Authorization", "Bearer "+string(adminJwt))
+		resp := doRequest(req, err)
+
+		assertStatus(t, 200, resp)
+		assertBody(t, "cake updated", resp)
+	})
+	t.Run("udate passwordHandler", func(t *testing.T) {
+		u := newTestUserService()
+		//users := NewInMemoryUserStorage()
+
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+
+		ts3 := httptest.NewServer(jwtAuth(j, u.repository, u.updatePasswordHandler))
+
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		params2 := map[string]interface{}{"password": "somenewpass"}
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+
+		Useruser, _ := u.repository.Get(context.Background(), "test@mail.com")
+		adminJwt, _ := j.GenearateJWT(Useruser)
+
+		req, err := newJSONRequest(http.MethodGet, ts3.URL, prepareParams(t, params2))
+		req.Header.Add("Authorization", "Bearer "+string(adminJwt))
+		resp := doRequest(req, err)
+
+		assertStatus(t, 200, resp)
+		assertBody(t, "password updated", resp)
+	})
+	t.Run("udate emailHandler", func(t *testing.T) {
+		mailer := &testMailer{}
+		u := newTestUserServiceWithMailer(mailer)
+		//users := NewInMemoryUserStorage()
+
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+
+		ts3 := httptest.NewServer(jwtAuth(j, u.repository, u.updateEmailHandler))
+
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		params2 := map[string]interface{}{
+			"email": "testnew@mail.com",
+		}
+		doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+
+		Useruser, _ := u.repository.Get(context.Background(), "test@mail.com")
+		adminJwt, _ := j.GenearateJWT(Useruser)
+
+		req, err := newJSONRequest(http.MethodGet, ts3.URL, prepareParams(t, params2))
+		req.Header.Add("Authorization", "Bearer "+string(adminJwt))
+		resp := doRequest(req, err)
+
+		assertStatus(t, 202, resp)
+		assertBody(t, "confirmation sent to testnew@mail.com", resp)
+		if _, err := u.repository.Get(context.Background(), "testnew@mail.com"); err == nil {
+			t.Error("email changed before confirmation")
+		}
+
+		ts4 := httptest.NewServer(http.HandlerFunc(u.confirmEmailHandler))
+		defer ts4.Close()
+		confirmParams := map[string]interface{}{
+			"token": mailer.lastToken(),
+		}
+		resp = doRequest(newJSONRequest(http.MethodPost, ts4.URL, prepareParams(t, confirmParams)))
+		assertStatus(t, 200, resp)
+		assertBody(t, "email updated", resp)
+
+		if _, err := u.repository.Get(context.Background(), "test@mail.com"); err == nil {
+			t.Error("old email still exists")
+		}
+		renamed, err := u.repository.Get(context.Background(), "testnew@mail.com")
+		if err != nil || renamed.FavoriteCake != "cheesecake" || renamed.PasswordDigest != Useruser.PasswordDigest {
+			t.Error("user fields were not kept after email change")
+		}
+
+		resp = doRequest(newJSONRequest(http.MethodPost, ts4.URL, prepareParams(t, confirmParams)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "invalid confirmation token", resp)
+	})
+	t.Run("udate emailHandler taken email", func(t *testing.T) {
+		u := newTestUserService()
+
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		ts3 := httptest.NewServer(jwtAuth(j, u.repository, u.updateEmailHandler))
+		defer ts.Close()
+		defer ts3.Close()
+
+		for _, email := range []string{"test@mail.com", "taken@mail.com"} {
+			params := map[string]interface{}{
+				"email":         email,
+				"password":      "somepass",
+				"favorite_cake": "cheesecake",
+			}
+			doRequest(newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, params)))
+		}
+
+		Useruser, _ := u.repository.Get(context.Background(), "test@mail.com")
+		userJwt, _ := j.GenearateJWT(Useruser)
+
+		params := map[string]interface{}{
+			"email": "taken@mail.com",
+		}
+		req, err := newJSONRequest(http.MethodPost, ts3.URL, prepareParams(t, params))
+		req.Header.Add("Authorization", "Bearer "+userJwt)
+		resp := doRequest(req, err)
+
+		assertStatus(t, 422, resp)
+		assertBody(t, "user with same login already exists", resp)
+		if _, err := u.repository.Get(context.Background(), "test@mail.com"); err != nil {
+			t.Error("user was lost after failed email change")
+		}
+	})
+
+	t.Run("validation password register", func(t *testing.T) {
+		u := newTestUserService()
+		_, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "sixlit",
+			"favorite_cake": "cheesecake",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "Password at least 8 symbols", resp)
+	})
+	t.Run("validation email register", func(t *testing.T) {
+		u := newTestUserService()
+		_, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "",
+			"password":      "sixflitff",
+			"favorite_cake": "cheesecake",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "The email field is required!", resp)
+	})
+	t.Run("validation email ", func(t *testing.T) {
+		u := newTestUserService()
+		_, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "213eurdf",
+			"password":      "sixflitff",
+			"favorite_cake": "cheesecake",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "The email field should be a valid email address!", resp)
+	})
+	t.Run("validation cake register", func(t *testing.T) {
+		u := newTestUserService()
+		_, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@gmail.com",
+			"password":      "sixflitff",
+			"favorite_cake": "",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "Favorite cake should not be empty", resp)
+	})
+	t.Run("validation cake alphabetic register", func(t *testing.T) {
+		u := newTestUserService()
+		_, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+		params := map[string]interface{}{
+			"email":         "test@gmail.com",
+			"password":      "sixflitff",
+			"favorite_cake": "346234566345",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/register", prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "Favorite cake should be only alphabetic", resp)
+	})
+
+	t.Run("jwt key by uncorrect passwd", func(t *testing.T) {
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(wrapJwt(j, u.JWT)))
+		ts2 := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer func() {
+			ts.Close()
+		}()
+
+		user := domain.User{
+			Email:          "test@gmail.com",
+			PasswordDigest: "newpassword",
+			FavoriteCake:   "cheesecake",
+		}
+		u.repository.Add(context.Background(), user.Email, user)
+
+		params := map[string]interface{}{
+			"email":         "test@gmail.com",
+			"password":      "newpassword",
+			"favorite_cake": "cheesecake",
+		}
+		params2 := map[string]interface{}{
+			"email":    "test@gmail.com",
+			"password": "newpasswo",
+		}
+		doRequest(newJSONRequest(http.MethodPost, ts2.URL+"/user/register", prepareParams(t, params)))
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL+"/user/jwt", prepareParams(t, params2)))
+		//jwt, _ := j.GenearateJWT(user)
+		assertStatus(t, 422, resp)
+		assertBody(t, "invalid login params", resp)
+	})
+
+	t.Run("email identity is case insensitive", func(t *testing.T) {
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		ts2 := httptest.NewServer(http.HandlerFunc(wrapJwt(j, u.JWT)))
+		defer ts.Close()
+		defer ts2.Close()
+
+		params := map[string]interface{}{
+			"email":         "Test@Mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, params)))
+		assertStatus(t, 201, resp)
+
+		params["email"] = "test@mail.com"
+		resp = doRequest(newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "user with same login already exists", resp)
+
+		params["email"] = "Name <test2@mail.com>"
+		resp = doRequest(newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "The email field should not contain a display name!", resp)
+
+		jwtParams := map[string]interface{}{
+			"email":    "TEST@mail.COM",
+			"password": "somepass",
+		}
+		resp = doRequest(newJSONRequest(http.MethodPost, ts2.URL, prepareParams(t, jwtParams)))
+		assertStatus(t, 200, resp)
+	})
+	t.Run("me as json", func(t *testing.T) {
+		u := newTestUserService()
+		j, err := auth.NewJWTService(testKeyPaths(t))
+		if err != nil {
+			t.FailNow()
+		}
+		ts := httptest.NewServer(jwtAuth(j, u.repository, getMeHandler))
+		defer ts.Close()
+
+		u.repository.Add(context.Background(), "test@mail.com", domain.User{Email: "test@mail.com", FavoriteCake: "cheesecake"})
+		Useruser, _ := u.repository.Get(context.Background(), "test@mail.com")
+		userJwt, _ := j.GenearateJWT(Useruser)
+
+		accepts := map[string]string{
+			"":                                 "cheesecaketest@mail.com",
+			"*/*":                              "cheesecaketest@mail.com",
+			"text/*, application/json;q=0.5":   "cheesecaketest@mail.com",
+			"application/json, text/plain;q=0": `{"email":"test@mail.com","favorite_cake":"cheesecake","role":"UserRole","banned":false}` + "\n",
+		}
+		for accept, expected := range accepts {
+			req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+			req.Header.Set("Authorization", "Bearer "+userJwt)
+			req.Header.Set("Accept", accept)
+			resp := doRequest(req, err)
+			assertStatus(t, 200, resp)
+			assertBody(t, expected, resp)
+		}
+	})
+	t.Run("strict params decoding", func(t *testing.T) {
+		u := newTestUserService()
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+
+		bodies := map[string]parsedResponse{
+			`{"email":"test@mail.com","password":"somepass","favorite_cake":"cheesecake","role":"AdminRole"}`: {422, []byte("role is not allowed")},
+			`{"email":"test@mail.com","password":8,"favorite_cake":"cheesecake"}`:                             {422, []byte("password should be a string")},
+			`{"email":"test@mail.com","password":"somepass","favorite_cake":"cheesecake"} {}`:                 {400, []byte("request body should contain a single JSON object")},
+			`{"email":"test@mail.com",`: {400, []byte("request body is not valid JSON")},
+			``:                          {400, []byte("request body is empty")},
+			`{"email":"` + strings.Repeat("a", maxBodySize) + `"}`: {413, []byte("request body too large")},
+		}
+		for body, expected := range bodies {
+			resp := doRequest(newJSONRequest(http.MethodPost, ts.URL, strings.NewReader(body)))
+			assertStatus(t, expected.status, resp)
+			assertBody(t, string(expected.body), resp)
+		}
+
+		params := map[string]interface{}{
+			"email":         "test@mail.com",
+			"password":      "somepass",
+			"favorite_cake": "cheesecake",
+		}
+		resp := doRequest(http.NewRequest(http.MethodPost, ts.URL, prepareParams(t, params)))
+		assertStatus(t, 415, resp)
+		assertBody(t, "Content-Type should be application/json", resp)
+	})
+	t.Run("oversized body is rejected before the handler", func(t *testing.T) {
+		called := false
+		ts := httptest.NewServer(logRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})))
+		defer ts.Close()
+
+		body := strings.NewReader(strings.Repeat("a", maxBodySize+1))
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL, body))
+		assertStatus(t, 413, resp)
+		if called {
+			t.Error("handler was called with oversized body")
+		}
+	})
+}
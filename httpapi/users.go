@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"golang-api/domain"
+	"golang-api/service"
+	"golang-api/storage"
+)
+
+// UserService adapts the user rules of service.Users to HTTP.
+type UserService struct {
+	users          *service.Users
+	repository     storage.UserRepository
+	passwordPolicy *domain.PasswordPolicy
+}
+
+func NewUserService(users *service.Users) *UserService {
+	return &UserService{
+		users:          users,
+		repository:     users.Repository(),
+		passwordPolicy: users.PasswordPolicy(),
+	}
+}
+
+type UserRegisterParams struct {
+	// If it looks strange, read about golang struct tags
+	Email        string `json:"email" validate:"required,email"`
+	Password     string `json:"password" validate:"required"`
+	FavoriteCake string `json:"favorite_cake" validate:"required,charset=alpha"`
+}
+
+func handleError(err error, w http.ResponseWriter) {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		handleErrorCode(reqErr.Err, reqErr.Status, w)
+	case errors.Is(err, service.ErrPreconditionFailed):
+		handleErrorCode(err, http.StatusPreconditionFailed, w)
+	case errors.Is(err, storage.ErrVersionConflict):
+		handleErrorCode(err, http.StatusConflict, w)
+	case errors.Is(err, context.DeadlineExceeded):
+		handleErrorCode(errors.New("storage timeout"), http.StatusGatewayTimeout, w)
+	case errors.Is(err, context.Canceled):
+		handleErrorCode(errors.New("request canceled"), http.StatusServiceUnavailable, w)
+	default:
+		handleErrorCode(err, http.StatusUnprocessableEntity, w)
+	}
+}
+
+func handleErrorCode(err error, code int, w http.ResponseWriter) {
+	w.WriteHeader(code)
+	w.Write([]byte(err.Error()))
+}
+
+func (u *UserService) Register(w http.ResponseWriter, r *http.Request) {
+	params := &UserRegisterParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if _, err := u.users.Register(r.Context(), service.RegisterParams(*params)); err != nil {
+		handleError(localizeError(r, err), w)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("registered"))
+}
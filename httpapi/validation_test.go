@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalization(t *testing.T) {
+	t.Run("preferred language", func(t *testing.T) {
+		headers := map[string]string{
+			"":                          "en",
+			"de-DE":                     "en",
+			"uk-UA,uk;q=0.9,en;q=0.8":   "uk",
+			"en;q=0.5, uk;q=0.7":        "uk",
+			"uk;q=0, en-US":             "en",
+			"fr-CH, fr;q=0.9, en;q=0.8": "en",
+		}
+		for header, expected := range headers {
+			r, _ := http.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Language", header)
+			if lang := preferredLanguage(r); lang != expected {
+				t.Errorf("%q: expected %s, actual %s", header, expected, lang)
+			}
+		}
+	})
+	t.Run("localized register errors", func(t *testing.T) {
+		doRequest := createRequester(t)
+		u := newTestUserService()
+		ts := httptest.NewServer(http.HandlerFunc(u.Register))
+		defer ts.Close()
+
+		params := map[string]interface{}{
+			"email":         "",
+			"password":      "short",
+			"favorite_cake": "cake42",
+		}
+		resp := doRequest(newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, params)))
+		assertStatus(t, 422, resp)
+		assertBody(t, "The email field is required!\n"+
+			"Favorite cake should be only alphabetic\n"+
+			"Password at least 8 symbols", resp)
+
+		req, err := newJSONRequest(http.MethodPost, ts.URL, prepareParams(t, params))
+		req.Header.Set("Accept-Language", "uk-UA")
+		resp = doRequest(req, err)
+		assertStatus(t, 422, resp)
+		assertBody(t, "Поле email обов'язкове!\n"+
+			"Улюблений торт може містити лише літери\n"+
+			"Пароль має містити щонайменше 8 символів", resp)
+	})
+}
@@ -0,0 +1,139 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-api/domain"
+)
+
+const (
+	contentTypeText = "text/plain"
+	contentTypeJSON = "application/json"
+)
+
+var errNotAcceptable = errors.New("supported formats are text/plain and application/json")
+
+type BanEventView struct {
+	Executor string `json:"executor"`
+	Banned   bool   `json:"banned"`
+	Reason   string `json:"reason,omitempty"`
+	// Time and Until are in RFC 3339 format
+	Time  string `json:"time"`
+	Until string `json:"until,omitempty"`
+}
+
+type UserView struct {
+	Email        string         `json:"email"`
+	FavoriteCake string         `json:"favorite_cake"`
+	Role         string         `json:"role"`
+	Banned       bool           `json:"banned"`
+	BanHistory   []BanEventView `json:"ban_history,omitempty"`
+	// DeletedAt and DeletedBy are only set for deleted users.
+	DeletedAt string `json:"deleted_at,omitempty"`
+	DeletedBy string `json:"deleted_by,omitempty"`
+}
+
+func newUserView(u domain.User, withHistory bool) UserView {
+	view := UserView{
+		Email:        u.Email,
+		FavoriteCake: u.FavoriteCake,
+		Role:         u.EffectiveRole(),
+		Banned:       u.Banned(time.Now()),
+		DeletedAt:    formatTime(u.DeletedAt),
+		DeletedBy:    u.DeletedBy,
+	}
+	if !withHistory {
+		return view
+	}
+	view.BanHistory = make([]BanEventView, 0, len(u.BanHistory))
+	for _, event := range u.BanHistory {
+		view.BanHistory = append(view.BanHistory, newBanEventView(event))
+	}
+	return view
+}
+
+// formatTime formats times of views in RFC 3339, zero times are empty.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func newBanEventView(event domain.BanHistoryList) BanEventView {
+	view := BanEventView{
+		Executor: event.Executor,
+		Banned:   event.IsBan,
+		Reason:   event.Reason,
+		Time:     event.Time.UTC().Format(time.RFC3339),
+	}
+	if !event.Until.IsZero() {
+		view.Until = event.Until.UTC().Format(time.RFC3339)
+	}
+	return view
+}
+
+// negotiate picks the offer the client prefers according to the Accept
+// header. The first offer is the default for clients that don't care.
+// The q of an offer comes from the most specific media range matching it,
+// so "text/plain;q=0, */*" excludes text/plain. An empty string means
+// that nothing offered is acceptable.
+func negotiate(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			s := mediaTypeSpecificity(mediaType, offer)
+			if s < 0 || s < specificity {
+				continue
+			}
+			rangeQ := 1.0
+			if value, ok := params["q"]; ok {
+				if rangeQ, err = strconv.ParseFloat(value, 64); err != nil {
+					continue
+				}
+			}
+			if s > specificity || rangeQ > q {
+				q, specificity = rangeQ, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// mediaTypeSpecificity is 2 when the media range names the offer, 1 for
+// type/* and 0 for */*. It is -1 when the range doesn't match the offer.
+func mediaTypeSpecificity(mediaRange, offer string) int {
+	switch {
+	case mediaRange == offer:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,156 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"golang-api/events"
+	"golang-api/webhooks"
+)
+
+type WebhookParams struct {
+	URL    string   `json:"url" validate:"required,max=2048"`
+	Events []string `json:"events"`
+	// Secret signs the deliveries, a random one is made when it is empty.
+	Secret string `json:"secret,omitempty" validate:"max=128"`
+}
+
+type WebhookView struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	CreatedAt string   `json:"created_at"`
+	// Secret is only in the response that creates the subscription.
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDeliveryView struct {
+	ID             string               `json:"id"`
+	SubscriptionID string               `json:"subscription_id"`
+	Event          events.Event         `json:"event"`
+	Status         string               `json:"status"`
+	CreatedAt      string               `json:"created_at"`
+	NextAttemptAt  string               `json:"next_attempt_at,omitempty"`
+	Attempts       []WebhookAttemptView `json:"attempts"`
+}
+
+type WebhookAttemptView struct {
+	Time       string `json:"time"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Manual     bool   `json:"manual,omitempty"`
+}
+
+func newWebhookView(s webhooks.Subscription) WebhookView {
+	return WebhookView{
+		ID:        s.ID,
+		URL:       s.URL,
+		Events:    s.Events,
+		CreatedAt: formatTime(s.Created),
+	}
+}
+
+func newWebhookDeliveryView(d webhooks.Delivery) WebhookDeliveryView {
+	view := WebhookDeliveryView{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		Event:          d.Event,
+		Status:         d.Status,
+		CreatedAt:      formatTime(d.Created),
+		NextAttemptAt:  formatTime(d.NextAttempt),
+		Attempts:       make([]WebhookAttemptView, 0, len(d.Attempts)),
+	}
+	for _, a := range d.Attempts {
+		view.Attempts = append(view.Attempts, WebhookAttemptView{
+			Time:       formatTime(a.Time),
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+			DurationMs: a.Duration.Milliseconds(),
+			Manual:     a.Manual,
+		})
+	}
+	return view
+}
+
+type webhookHandlers struct {
+	*webhooks.Dispatcher
+}
+
+func (h webhookHandlers) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	params := &WebhookParams{}
+	if err := decodeJSON(w, r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	if err := validateRequest(r, params); err != nil {
+		handleError(err, w)
+		return
+	}
+	sub, err := h.Subscribe(r.Context(), params.URL, params.Secret, params.Events)
+	if err != nil {
+		handleError(localizeError(r, err), w)
+		return
+	}
+	view := newWebhookView(sub)
+	view.Secret = sub.Secret
+	writeJSON(w, http.StatusCreated, view)
+}
+
+func (h webhookHandlers) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.Store().Subscriptions(r.Context())
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	views := make([]WebhookView, 0, len(subs))
+	for _, sub := range subs {
+		views = append(views, newWebhookView(sub))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (h webhookHandlers) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store().RemoveSubscription(r.Context(), mux.Vars(r)["id"]); err != nil {
+		handleWebhookError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("webhook deleted"))
+}
+
+// listDeliveriesHandler shows the delivery log of a subscription, it is
+// kept after the subscription is deleted.
+func (h webhookHandlers) listDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.Store().Deliveries(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+	views := make([]WebhookDeliveryView, 0, len(deliveries))
+	for _, d := range deliveries {
+		views = append(views, newWebhookDeliveryView(d))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// redeliverHandler sends a delivery again right away and responds with
+// its log, the new attempt is the last one.
+func (h webhookHandlers) redeliverHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.Redeliver(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		handleWebhookError(err, w)
+		return
+	}
+	writeJSON(w, http.StatusOK, newWebhookDeliveryView(delivery))
+}
+
+func handleWebhookError(err error, w http.ResponseWriter) {
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) || errors.Is(err, webhooks.ErrDeliveryNotFound) {
+		handleErrorCode(err, http.StatusNotFound, w)
+		return
+	}
+	handleError(err, w)
+}
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/webhooks"
+)
+
+func TestWebhooks(t *testing.T) {
+	doRequest := createRequester(t)
+	ctx := context.Background()
+
+	received := make(chan *http.Request, 10)
+	var status int32 = http.StatusInternalServerError
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := webhooks.Verify("topsecret", r.Header.Get(webhooks.SignatureHeader), body, time.Now(), time.Minute); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		received <- r
+	}))
+	defer receiver.Close()
+
+	u := newTestUserService()
+	j, err := auth.NewJWTService(testKeyPaths(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the receiver listens on loopback, which the default client refuses
+	dispatcher := webhooks.NewDispatcher(webhooks.NewInMemoryStore(), &http.Client{Timeout: 5 * time.Second}, webhooks.DefaultRetryPolicy())
+	ts := httptest.NewServer(NewRouter(u, j, RouterConfig{LegacySunset: time.Now().Add(time.Hour), Webhooks: dispatcher}))
+	defer ts.Close()
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go dispatcher.Run(runCtx, u.users.Events(), time.Hour)
+
+	u.users.AddAdmin(ctx, "admin@mail.com", "adminadmin")
+	admin, _ := u.repository.Get(ctx, "admin@mail.com")
+	adminToken, _ := j.GenerateMFAJWT(admin)
+	adminRequest := func(method, path string, params map[string]interface{}) parsedResponse {
+		var req *http.Request
+		var err error
+		if params != nil {
+			req, err = newJSONRequest(method, ts.URL+path, prepareParams(t, params))
+		} else {
+			req, err = http.NewRequest(method, ts.URL+path, nil)
+		}
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+		}
+		return doRequest(req, err)
+	}
+
+	resp := adminRequest(http.MethodPost, "/v2/admin/webhooks", map[string]interface{}{
+		"url": "mailto:crm@example.com", "events": []string{"user.registered"},
+	})
+	assertStatus(t, 422, resp)
+	assertBody(t, "The url field should be an http or https URL", resp)
+
+	resp = adminRequest(http.MethodPost, "/v2/admin/webhooks", map[string]interface{}{
+		"url": receiver.URL, "events": []string{"user.registered", "user.banned"}, "secret": "topsecret",
+	})
+	assertStatus(t, 201, resp)
+	created := WebhookView{}
+	json.Unmarshal(resp.body, &created)
+	if created.Secret != "topsecret" {
+		t.Error("no secret in the created webhook", string(resp.body))
+	}
+	resp = adminRequest(http.MethodGet, "/v2/admin/webhooks", nil)
+	assertStatus(t, 200, resp)
+	list := []WebhookView{}
+	json.Unmarshal(resp.body, &list)
+	if len(list) != 1 || list[0].ID != created.ID || list[0].Secret != "" {
+		t.Error("unexpected webhooks", string(resp.body))
+	}
+
+	// the receiver fails, the delivery waits for a retry
+	doRequest(newJSONRequest(http.MethodPost, ts.URL+"/v2/user/register", prepareParams(t, map[string]interface{}{
+		"email": "test@mail.com", "password": "somepass", "favorite_cake": "cheesecake",
+	})))
+	select {
+	case r := <-received:
+		if r.Header.Get(webhooks.EventHeader) != "user.registered" {
+			t.Error("unexpected event", r.Header.Get(webhooks.EventHeader))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	var deliveries []WebhookDeliveryView
+	for deadline := time.Now().Add(5 * time.Second); len(deliveries) == 0 || len(deliveries[0].Attempts) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("attempt was not logged")
+		}
+		resp = adminRequest(http.MethodGet, "/v2/admin/webhooks/"+created.ID+"/deliveries", nil)
+		json.Unmarshal(resp.body, &deliveries)
+	}
+	if deliveries[0].Status != "pending" || deliveries[0].Attempts[0].StatusCode != 500 || deliveries[0].NextAttemptAt == "" {
+		t.Error("unexpected delivery log", string(resp.body))
+	}
+
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	resp = adminRequest(http.MethodPost, "/v2/admin/webhooks/deliveries/"+deliveries[0].ID+"/redeliver", nil)
+	assertStatus(t, 200, resp)
+	<-received
+	redelivered := WebhookDeliveryView{}
+	json.Unmarshal(resp.body, &redelivered)
+	if redelivered.Status != "delivered" || len(redelivered.Attempts) != 2 || !redelivered.Attempts[1].Manual {
+		t.Error("unexpected redelivery", string(resp.body))
+	}
+	resp = adminRequest(http.MethodPost, "/v2/admin/webhooks/deliveries/dlv_missing/redeliver", nil)
+	assertStatus(t, 404, resp)
+
+	resp = adminRequest(http.MethodDelete, "/v2/admin/webhooks/"+created.ID, nil)
+	assertStatus(t, 200, resp)
+	resp = adminRequest(http.MethodDelete, "/v2/admin/webhooks/"+created.ID, nil)
+	assertStatus(t, 404, resp)
+}
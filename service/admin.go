@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"golang-api/domain"
+	"golang-api/events"
+)
+
+// moderate loads the target of a ban or an unban. Only admins moderate.
+func (s *Users) moderate(ctx context.Context, actor domain.User, target string) (domain.User, error) {
+	email, err := moderationTarget(actor, target)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return s.repository.Get(ctx, email)
+}
+
+func moderationTarget(actor domain.User, target string) (string, error) {
+	if actor.EffectiveRole() != "AdminRole" {
+		return "", ErrPermissionDenied
+	}
+	return domain.NormalizeEmail(target)
+}
+
+// Ban bans the target user until the given time, a zero until makes the
+// ban permanent. The ban is recorded in the history of the user.
+func (s *Users) Ban(ctx context.Context, actor domain.User, target, reason string, until time.Time) (domain.User, error) {
+	now := time.Now()
+	if !until.IsZero() && !until.After(now) {
+		return domain.User{}, ErrBanInPast
+	}
+	user, err := s.moderate(ctx, actor, target)
+	if err != nil {
+		return user, err
+	}
+	banned := user
+	banned.Ban = true
+	banned.BanUntil = until
+	banned.BanHistory = append(user.BanHistory, domain.BanHistoryList{
+		Executor: actor.Email,
+		IsBan:    true,
+		Time:     now,
+		Reason:   reason,
+		Until:    until,
+	})
+	if banned, err = s.update(ctx, user, banned); err != nil {
+		return banned, err
+	}
+	s.events.Publish(events.Event{Type: events.UserBanned, Email: banned.Email, Actor: actor.Email, Reason: reason})
+	return banned, nil
+}
+
+func (s *Users) Unban(ctx context.Context, actor domain.User, target string) (domain.User, error) {
+	user, err := s.moderate(ctx, actor, target)
+	if err != nil {
+		return user, err
+	}
+	unbanned := user
+	unbanned.Ban = false
+	unbanned.BanUntil = time.Time{}
+	unbanned.BanHistory = append(user.BanHistory, domain.BanHistoryList{
+		Executor: actor.Email,
+		IsBan:    false,
+		Time:     time.Now(),
+	})
+	if unbanned, err = s.update(ctx, user, unbanned); err != nil {
+		return unbanned, err
+	}
+	s.events.Publish(events.Event{Type: events.UserUnbanned, Email: unbanned.Email, Actor: actor.Email})
+	return unbanned, nil
+}
+
+// DeleteUser soft deletes the target. The user can't log in, but the record
+// is kept as a tombstone: it can be restored, and its email can't be
+// registered again until PurgeUser or PurgeTombstones remove it.
+func (s *Users) DeleteUser(ctx context.Context, actor domain.User, target string) (domain.User, error) {
+	user, err := s.moderate(ctx, actor, target)
+	if err != nil {
+		return user, err
+	}
+	if user.Email == actor.Email {
+		return user, ErrDeleteSelf
+	}
+	deleted := user
+	deleted.DeletedAt = time.Now()
+	deleted.DeletedBy = actor.Email
+	if deleted, err = s.update(ctx, user, deleted); err != nil {
+		return deleted, err
+	}
+	s.events.Publish(events.Event{Type: events.UserDeleted, Email: deleted.Email, Actor: actor.Email})
+	return deleted, nil
+}
+
+func (s *Users) RestoreUser(ctx context.Context, actor domain.User, target string) (domain.User, error) {
+	email, err := moderationTarget(actor, target)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user, err := s.repository.Restore(ctx, email)
+	if err != nil {
+		return user, err
+	}
+	s.events.Publish(events.Event{Type: events.UserRestored, Email: user.Email, Actor: actor.Email})
+	return user, nil
+}
+
+// PurgeUser removes the tombstone of a deleted user for good, only
+// deleted users can be purged.
+func (s *Users) PurgeUser(ctx context.Context, actor domain.User, target string) (domain.User, error) {
+	email, err := moderationTarget(actor, target)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user, err := s.repository.GetDeleted(ctx, email)
+	if err != nil {
+		return user, err
+	}
+	return user, s.purge(ctx, user, events.Event{Type: events.UserPurged, Actor: actor.Email})
+}
+
+// purge deletes a tombstone after giving the records of the user an
+// alias, see PurgeDeleted, and publishes e about the alias. The delete
+// fails with ErrVersionConflict when the tombstone changed since it was
+// read, for example when it was restored.
+func (s *Users) purge(ctx context.Context, tombstone domain.User, e events.Event) error {
+	alias, err := s.anonymizeRecords(ctx, tombstone.Email)
+	if err != nil {
+		return err
+	}
+	if _, err := s.repository.CompareAndDelete(ctx, tombstone.Email, tombstone.Version); err != nil {
+		return err
+	}
+	e.Email = alias
+	s.events.Publish(e)
+	return nil
+}
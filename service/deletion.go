@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"golang-api/domain"
+	"golang-api/events"
+	"golang-api/storage"
+)
+
+// DeletionGraceFromEnv reads the grace period of account deletions from
+// CAKE_DELETION_GRACE, e.g. "720h".
+func DeletionGraceFromEnv() (time.Duration, error) {
+	value := os.Getenv("CAKE_DELETION_GRACE")
+	if value == "" {
+		return DefaultDeletionGrace, nil
+	}
+	grace, err := time.ParseDuration(value)
+	if err == nil && grace < 0 {
+		err = errors.New("deletion grace period should not be negative")
+	}
+	return grace, err
+}
+
+// TombstoneRetentionFromEnv reads how many days the tombstones of users
+// deleted by admins are kept from CAKE_TOMBSTONE_RETENTION_DAYS.
+func TombstoneRetentionFromEnv() (time.Duration, error) {
+	value := os.Getenv("CAKE_TOMBSTONE_RETENTION_DAYS")
+	if value == "" {
+		return DefaultTombstoneRetention, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, errors.New("tombstone retention should be a number of days")
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// RequestDeletion schedules the deletion of the account after the grace
+// period, the user confirms it with the password. Until then the user
+// can log in and cancel it.
+func (s *Users) RequestDeletion(ctx context.Context, email, password string) (domain.User, error) {
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.ServiceAccount || passwordDigest(password) != user.PasswordDigest {
+		return user, ErrInvalidCredentials
+	}
+	if !user.DeleteAfter.IsZero() {
+		return user, nil
+	}
+	changed := user
+	changed.DeleteAfter = time.Now().Add(s.deletionGrace)
+	return s.update(ctx, user, changed)
+}
+
+func (s *Users) CancelDeletion(ctx context.Context, email string) (domain.User, error) {
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.DeleteAfter.IsZero() {
+		return user, nil
+	}
+	changed := user
+	changed.DeleteAfter = time.Time{}
+	return s.update(ctx, user, changed)
+}
+
+// eachUser calls f with every stored user matching the filter, page by page.
+func (s *Users) eachUser(ctx context.Context, filter storage.UserFilter, f func(domain.User) error) error {
+	page := storage.Page{Limit: storage.MaxPageLimit}
+	for {
+		result, err := s.repository.List(ctx, filter, page)
+		if err != nil {
+			return err
+		}
+		for _, u := range result.Users {
+			if err := f(u); err != nil {
+				return err
+			}
+		}
+		if result.NextCursor == "" {
+			return nil
+		}
+		page.Cursor = result.NextCursor
+	}
+}
+
+// PurgeDeleted deletes the accounts whose grace period is over at now.
+// The moderation records they made in the history of other users and
+// tombstones, the buffered events and the records of the record keepers
+// are given an alias instead of the email, and the events of the purge
+// name the user by the alias. It returns the deleted emails, so callers
+// can drop what they keep about them, like sessions.
+func (s *Users) PurgeDeleted(ctx context.Context, now time.Time) ([]string, error) {
+	var due []string
+	err := s.eachUser(ctx, storage.UserFilter{}, func(u domain.User) error {
+		if !u.DeleteAfter.IsZero() && !u.DeleteAfter.After(now) {
+			due = append(due, u.Email)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	purged := make([]string, 0, len(due))
+	for _, email := range due {
+		// the user may have canceled since the scan
+		user, err := s.repository.Get(ctx, email)
+		if err != nil || user.DeleteAfter.IsZero() || user.DeleteAfter.After(now) {
+			continue
+		}
+		// the user becomes a tombstone only if it is still the version
+		// read, a cancel made in between wins. From then on cancels find
+		// no user, and when the purge fails below PurgeTombstones
+		// finishes it.
+		tombstone := user
+		tombstone.DeletedAt = now
+		err = s.repository.CompareAndUpdate(ctx, email, user.Version, tombstone)
+		if errors.Is(err, storage.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		tombstone.Version = user.Version + 1
+		err = s.purge(ctx, tombstone, events.Event{Type: events.AccountClosed})
+		if errors.Is(err, storage.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged = append(purged, email)
+	}
+	return purged, nil
+}
+
+// Revoker ends what a user can still log in with, auth.JWTService is one.
+type Revoker interface {
+	RevokeUser(ctx context.Context, email string) error
+}
+
+// PurgeDeletedAndRevoke is PurgeDeleted that also revokes the sessions
+// and API keys of the purged users, otherwise they would log in to a new
+// account registered with the same email. A failed revocation doesn't
+// stop the others, the first error is returned.
+func (s *Users) PurgeDeletedAndRevoke(ctx context.Context, now time.Time, r Revoker) ([]string, error) {
+	purged, err := s.PurgeDeleted(ctx, now)
+	return purged, revokeAll(ctx, r, purged, err)
+}
+
+// PurgeTombstonesAndRevoke is PurgeTombstones that also revokes the API
+// keys the purged users kept while they were deleted.
+func (s *Users) PurgeTombstonesAndRevoke(ctx context.Context, before time.Time, r Revoker) ([]string, error) {
+	purged, err := s.PurgeTombstones(ctx, before)
+	return purged, revokeAll(ctx, r, purged, err)
+}
+
+// revokeAll revokes the credentials of the purged users and returns err,
+// or the first failed revocation when err is nil.
+func revokeAll(ctx context.Context, r Revoker, purged []string, err error) error {
+	for _, email := range purged {
+		if rerr := r.RevokeUser(ctx, email); rerr != nil && err == nil {
+			err = fmt.Errorf("revoke credentials of %s: %w", email, rerr)
+		}
+	}
+	return err
+}
+
+// PurgeTombstones purges the users admins deleted before the given time
+// and returns their emails.
+func (s *Users) PurgeTombstones(ctx context.Context, before time.Time) ([]string, error) {
+	var due []string
+	err := s.eachUser(ctx, storage.UserFilter{Deleted: true}, func(u domain.User) error {
+		if u.DeletedAt.Before(before) {
+			due = append(due, u.Email)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	purged := make([]string, 0, len(due))
+	for _, email := range due {
+		// the user may have been restored since the scan
+		tombstone, err := s.repository.GetDeleted(ctx, email)
+		if err != nil {
+			continue
+		}
+		err = s.purge(ctx, tombstone, events.Event{Type: events.UserPurged})
+		if errors.Is(err, storage.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged = append(purged, email)
+	}
+	return purged, nil
+}
+
+// RecordKeeper keeps records about users outside of the repository, like
+// the webhook delivery log. Purges replace the email in them with an alias.
+type RecordKeeper interface {
+	Anonymize(ctx context.Context, email, alias string) error
+}
+
+// AddRecordKeeper makes purges anonymize the records of k as well.
+func (s *Users) AddRecordKeeper(k RecordKeeper) {
+	s.keepers = append(s.keepers, k)
+}
+
+// anonymizeRecords replaces the email of a user in the ban history of
+// others, the buffered events and the records of the keepers with an
+// alias that can't be traced back to it, and returns the alias.
+// Tombstones are included, or the email would come back when one is
+// restored.
+func (s *Users) anonymizeRecords(ctx context.Context, email string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	alias := "deleted-user-" + token[:12]
+	err = s.eachUser(ctx, storage.UserFilter{}, func(u domain.User) error {
+		return s.aliasExecutor(ctx, u, email, alias, s.repository.CompareAndUpdate, s.repository.Get)
+	})
+	if err != nil {
+		return "", err
+	}
+	err = s.eachUser(ctx, storage.UserFilter{Deleted: true}, func(u domain.User) error {
+		if u.Email == email {
+			return nil
+		}
+		return s.aliasExecutor(ctx, u, email, alias, s.repository.CompareAndUpdateDeleted, s.repository.GetDeleted)
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, k := range s.keepers {
+		if err := k.Anonymize(ctx, email, alias); err != nil {
+			return "", err
+		}
+	}
+	s.events.Anonymize(email, alias)
+	return alias, nil
+}
+
+// aliasExecutor gives the records of email in the history of u the
+// alias, it reads u again with get when it changed in between.
+func (s *Users) aliasExecutor(ctx context.Context, u domain.User, email, alias string,
+	update func(context.Context, string, int, domain.User) error,
+	get func(context.Context, string) (domain.User, error)) error {
+	for {
+		changed, ok := replaceExecutor(u, email, alias)
+		if !ok {
+			return nil
+		}
+		err := update(ctx, u.Email, u.Version, changed)
+		if !errors.Is(err, storage.ErrVersionConflict) {
+			return err
+		}
+		if u, err = get(ctx, u.Email); err != nil {
+			return err
+		}
+	}
+}
+
+func replaceExecutor(u domain.User, email, alias string) (domain.User, bool) {
+	found := false
+	history := make(domain.History, len(u.BanHistory))
+	for i, record := range u.BanHistory {
+		if record.Executor == email {
+			record.Executor = alias
+			found = true
+		}
+		history[i] = record
+	}
+	u.BanHistory = history
+	return u, found
+}
+
+// AuditEntry is a moderation action a user took on Target.
+type AuditEntry struct {
+	Target string
+	domain.BanHistoryList
+}
+
+// Export is everything the service holds about a user. Transports add
+// what they keep themselves, like sessions.
+type Export struct {
+	User         domain.User
+	AuditEntries []AuditEntry
+}
+
+func (s *Users) Export(ctx context.Context, email string) (Export, error) {
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return Export{}, err
+	}
+	export := Export{User: user, AuditEntries: []AuditEntry{}}
+	err = s.eachUser(ctx, storage.UserFilter{}, func(u domain.User) error {
+		for _, record := range u.BanHistory {
+			if record.Executor == email {
+				export.AuditEntries = append(export.AuditEntries, AuditEntry{Target: u.Email, BanHistoryList: record})
+			}
+		}
+		return nil
+	})
+	return export, err
+}
@@ -0,0 +1,138 @@
+// Package service has the business rules of the API independent of the
+// transport: registration, profile updates, email changes, password
+// resets and bans. Handlers, CLIs and batch jobs are thin adapters over
+// Users and turn its errors into their own responses.
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"golang-api/domain"
+	"golang-api/events"
+	"golang-api/storage"
+)
+
+const (
+	emailChangeTTL   = 24 * time.Hour
+	passwordResetTTL = time.Hour
+	// DefaultDeletionGrace is how long users can cancel the deletion of
+	// their account.
+	DefaultDeletionGrace = 30 * 24 * time.Hour
+	// DefaultTombstoneRetention is how long users deleted by admins can
+	// be restored.
+	DefaultTombstoneRetention = 30 * 24 * time.Hour
+)
+
+// Errors of the service. Invalid params are reported as domain.FieldErrors,
+// storage.ErrUserExists, storage.ErrVersionConflict and storage.ErrNotDeleted
+// are passed through.
+var (
+	ErrInvalidCredentials = errors.New("invalid login params")
+	ErrInvalidMFACode     = errors.New("invalid two-factor code")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrPreconditionFailed = errors.New("user was modified, reload it and try again")
+	ErrBanInPast          = errors.New("ban should end in the future")
+	ErrDeleteSelf         = errors.New("admins can't delete their own account")
+)
+
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer does not send anything, it only prints the letter to the log.
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("MAIL to %s: %s\n\t%s", to, subject, body)
+	return nil
+}
+
+type Users struct {
+	repository     storage.UserRepository
+	emailChanges   *storage.InMemoryEmailChangeStorage
+	passwordResets *storage.InMemoryPasswordResetStorage
+	mailer         Mailer
+	passwordPolicy *domain.PasswordPolicy
+	events         *events.Bus
+	deletionGrace  time.Duration
+	// keepers are anonymized by purges, see AddRecordKeeper
+	keepers []RecordKeeper
+}
+
+func NewUsers(repository storage.UserRepository, mailer Mailer, policy *domain.PasswordPolicy) *Users {
+	return &Users{
+		repository:     repository,
+		emailChanges:   storage.NewInMemoryEmailChangeStorage(),
+		passwordResets: storage.NewInMemoryPasswordResetStorage(),
+		mailer:         mailer,
+		passwordPolicy: policy,
+		events:         events.NewBus(events.DefaultBufferSize),
+		deletionGrace:  DefaultDeletionGrace,
+	}
+}
+
+func (s *Users) Repository() storage.UserRepository {
+	return s.repository
+}
+
+func (s *Users) PasswordPolicy() *domain.PasswordPolicy {
+	return s.passwordPolicy
+}
+
+// SetDeletionGrace changes how long deleted accounts wait before they
+// are purged, it applies to deletions requested afterwards.
+func (s *Users) SetDeletionGrace(grace time.Duration) {
+	s.deletionGrace = grace
+}
+
+// Events is the bus the changes of users are published to.
+func (s *Users) Events() *events.Bus {
+	return s.events
+}
+
+type preconditionKey struct{}
+
+// WithPrecondition makes updates made with the context fail with
+// ErrPreconditionFailed unless match accepts the stored user. Transports
+// use it for conditional requests such as If-Match.
+func WithPrecondition(ctx context.Context, match func(domain.User) bool) context.Context {
+	return context.WithValue(ctx, preconditionKey{}, match)
+}
+
+func checkPrecondition(ctx context.Context, u domain.User) error {
+	if match, ok := ctx.Value(preconditionKey{}).(func(domain.User) bool); ok && !match(u) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// update stores the changed user if the precondition of the context holds
+// and returns it with its new version.
+func (s *Users) update(ctx context.Context, current, changed domain.User) (domain.User, error) {
+	if err := checkPrecondition(ctx, current); err != nil {
+		return current, err
+	}
+	if err := s.repository.CompareAndUpdate(ctx, current.Email, current.Version, changed); err != nil {
+		return current, err
+	}
+	changed.Version = current.Version + 1
+	return changed, nil
+}
+
+func passwordDigest(password string) string {
+	return string(md5.New().Sum([]byte(password)))
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"golang-api/auth"
+	"golang-api/domain"
+	"golang-api/events"
+	"golang-api/storage"
+)
+
+type RegisterParams struct {
+	Email        string `json:"email" validate:"required,email"`
+	Password     string `json:"password" validate:"required"`
+	FavoriteCake string `json:"favorite_cake" validate:"required,charset=alpha"`
+}
+
+// ProfileParams are the fields users may change about themselves.
+type ProfileParams struct {
+	FavoriteCake string `json:"favorite_cake" validate:"required,charset=alpha"`
+}
+
+// checkPassword reports the violations of the password policy, users
+// built without a policy take any password.
+func (s *Users) checkPassword(password, email, cake string) (domain.FieldErrors, error) {
+	if s.passwordPolicy == nil {
+		return nil, nil
+	}
+	return s.passwordPolicy.Check(password, email, cake)
+}
+
+// Register adds a plain user. All problems with the params are reported
+// at once as domain.FieldErrors.
+func (s *Users) Register(ctx context.Context, params RegisterParams) (domain.User, error) {
+	errs := domain.Validate(&params)
+	policyErrs, err := s.checkPassword(params.Password, params.Email, params.FavoriteCake)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if errs = append(errs, policyErrs...); len(errs) > 0 {
+		return domain.User{}, errs
+	}
+	email, err := domain.NormalizeEmail(params.Email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user := domain.User{
+		Email:          email,
+		PasswordDigest: passwordDigest(params.Password),
+		FavoriteCake:   params.FavoriteCake,
+	}
+	if err := s.repository.Add(ctx, email, user); err != nil {
+		return domain.User{}, err
+	}
+	user.Version = 1
+	s.events.Publish(events.Event{Type: events.UserRegistered, Email: email})
+	return user, nil
+}
+
+// Login checks the password of a user. Service accounts have no
+// password and can't log in.
+func (s *Users) Login(ctx context.Context, email, password string) (domain.User, error) {
+	email, err := domain.NormalizeEmail(email)
+	if err != nil {
+		return domain.User{}, ErrInvalidCredentials
+	}
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.ServiceAccount || passwordDigest(password) != user.PasswordDigest {
+		return domain.User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// VerifySecondFactor is the second login step of users with 2FA. It takes
+// a TOTP or recovery code and saves the user so that the code can't be
+// used again.
+func (s *Users) VerifySecondFactor(ctx context.Context, email, code string) (domain.User, error) {
+	user, err := s.repository.Get(ctx, email)
+	if err != nil || !user.MFA.Enabled {
+		return domain.User{}, ErrInvalidCredentials
+	}
+	verified, ok := auth.CheckSecondFactor(user, code)
+	if !ok {
+		return user, ErrInvalidMFACode
+	}
+	if err := s.repository.CompareAndUpdate(ctx, user.Email, user.Version, verified); err != nil {
+		return user, err
+	}
+	verified.Version = user.Version + 1
+	return verified, nil
+}
+
+func (s *Users) UpdateProfile(ctx context.Context, email string, params ProfileParams) (domain.User, error) {
+	if errs := domain.Validate(&params); errs != nil {
+		return domain.User{}, errs
+	}
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	changed := user
+	changed.FavoriteCake = params.FavoriteCake
+	if changed, err = s.update(ctx, user, changed); err != nil {
+		return changed, err
+	}
+	s.events.Publish(events.Event{Type: events.ProfileUpdated, Email: changed.Email})
+	return changed, nil
+}
+
+func (s *Users) ChangePassword(ctx context.Context, email, password string) (domain.User, error) {
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	errs, err := s.checkPassword(password, user.Email, user.FavoriteCake)
+	if err != nil {
+		return user, err
+	}
+	if len(errs) > 0 {
+		return user, errs
+	}
+	changed := user
+	changed.PasswordDigest = passwordDigest(password)
+	if changed, err = s.update(ctx, user, changed); err != nil {
+		return changed, err
+	}
+	s.events.Publish(events.Event{Type: events.PasswordChanged, Email: changed.Email})
+	return changed, nil
+}
+
+// RequestEmailChange mails a confirmation token to the new address, the
+// email changes once ConfirmEmailChange gets the token. It returns the
+// new address in its canonical form.
+func (s *Users) RequestEmailChange(ctx context.Context, email, newEmail string) (string, error) {
+	newEmail, err := domain.NormalizeEmail(newEmail)
+	if err != nil {
+		return "", err
+	}
+	// deleted users keep their email until they are purged
+	_, err = s.repository.Get(ctx, newEmail)
+	if err != nil {
+		_, err = s.repository.GetDeleted(ctx, newEmail)
+	}
+	if err == nil {
+		return "", storage.ErrUserExists
+	}
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if err := checkPrecondition(ctx, user); err != nil {
+		return "", err
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	s.emailChanges.Add(token, storage.EmailChange{
+		OldEmail: user.Email,
+		NewEmail: newEmail,
+		Expires:  time.Now().Add(emailChangeTTL),
+	})
+	err = s.mailer.Send(newEmail, "Confirm your new email",
+		"Use this token to confirm the email change: "+token)
+	return newEmail, err
+}
+
+func (s *Users) ConfirmEmailChange(ctx context.Context, token string) error {
+	change, err := s.emailChanges.Take(token)
+	if err != nil {
+		return err
+	}
+	if err := s.repository.Rename(ctx, change.OldEmail, change.NewEmail); err != nil {
+		return err
+	}
+	s.events.Publish(events.Event{Type: events.EmailChanged, Email: change.NewEmail, PreviousEmail: change.OldEmail})
+	return nil
+}
+
+// RequestPasswordReset mails a reset token if the user exists. Unknown
+// emails are not an error so that callers can't tell which users exist.
+func (s *Users) RequestPasswordReset(ctx context.Context, email string) (string, error) {
+	email, err := domain.NormalizeEmail(email)
+	if err != nil {
+		return "", err
+	}
+	user, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return email, nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return email, err
+	}
+	s.passwordResets.Add(token, storage.PasswordReset{
+		Email:   user.Email,
+		Version: user.Version,
+		Expires: time.Now().Add(passwordResetTTL),
+	})
+	err = s.mailer.Send(user.Email, "Reset your password",
+		"Use this token to set a new password: "+token)
+	return email, err
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset.
+// The token only works while the user is unchanged since it was sent.
+func (s *Users) ResetPassword(ctx context.Context, token, password string) error {
+	reset, err := s.passwordResets.Take(token)
+	if err != nil {
+		return err
+	}
+	user, err := s.repository.Get(ctx, reset.Email)
+	if err != nil {
+		return err
+	}
+	errs, err := s.checkPassword(password, user.Email, user.FavoriteCake)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		// a weak password should not cost the user the token
+		s.passwordResets.Add(token, reset)
+		return errs
+	}
+	user.PasswordDigest = passwordDigest(password)
+	if err := s.repository.CompareAndUpdate(ctx, reset.Email, reset.Version, user); err != nil {
+		return err
+	}
+	s.events.Publish(events.Event{Type: events.PasswordChanged, Email: user.Email})
+	return nil
+}
+
+func (s *Users) AddAdmin(ctx context.Context, email, password string) error {
+	email, err := domain.NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	admin := domain.User{
+		Email:          email,
+		PasswordDigest: passwordDigest(password),
+		FavoriteCake:   "AdminCake",
+		Role:           "AdminRole",
+		BanHistory:     domain.History{},
+	}
+	return s.repository.Add(ctx, admin.Email, admin)
+}
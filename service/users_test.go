@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-api/domain"
+	"golang-api/events"
+	"golang-api/storage"
+	"golang-api/webhooks"
+)
+
+type nopMailer struct{}
+
+func (nopMailer) Send(to, subject, body string) error { return nil }
+
+// revoker remembers whom it revoked and fails for the emails in fail.
+type revoker struct {
+	revoked []string
+	fail    map[string]bool
+}
+
+func (r *revoker) RevokeUser(ctx context.Context, email string) error {
+	if r.fail[email] {
+		return errors.New("sessions are unavailable")
+	}
+	r.revoked = append(r.revoked, email)
+	return nil
+}
+
+// racingRepository runs afterGet once right after a Get, like a request
+// that comes in between a read and the write that follows it.
+type racingRepository struct {
+	storage.UserRepository
+	afterGet func()
+}
+
+func (r *racingRepository) Get(ctx context.Context, key string) (domain.User, error) {
+	u, err := r.UserRepository.Get(ctx, key)
+	if f := r.afterGet; f != nil {
+		r.afterGet = nil
+		f()
+	}
+	return u, err
+}
+
+func newTestUsers(t *testing.T) (*Users, domain.User) {
+	s := NewUsers(storage.FromLegacy(storage.NewInMemoryUserStorage()), nopMailer{}, domain.DefaultPasswordPolicy())
+	ctx := context.Background()
+	if err := s.AddAdmin(ctx, "admin@mail.com", "adminadmin"); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := s.Repository().Get(ctx, "admin@mail.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, admin
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("register", func(t *testing.T) {
+		s, _ := newTestUsers(t)
+		user, err := s.Register(ctx, RegisterParams{Email: "Test@Mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "test@mail.com" || user.Version != 1 {
+			t.Error("unexpected user", user)
+		}
+		_, err = s.Register(ctx, RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		if !errors.Is(err, storage.ErrUserExists) {
+			t.Error("registered the same email twice", err)
+		}
+		var errs domain.FieldErrors
+		_, err = s.Register(ctx, RegisterParams{Email: "bad", Password: "short", FavoriteCake: "cake1"})
+		if !errors.As(err, &errs) || len(errs) != 3 {
+			t.Error("expected all field errors at once", err)
+		}
+	})
+
+	t.Run("login", func(t *testing.T) {
+		s, _ := newTestUsers(t)
+		if _, err := s.Login(ctx, "Admin@mail.com", "adminadmin"); err != nil {
+			t.Error(err)
+		}
+		if _, err := s.Login(ctx, "admin@mail.com", "wrong"); err != ErrInvalidCredentials {
+			t.Error("logged in with a wrong password", err)
+		}
+	})
+
+	t.Run("ban and unban", func(t *testing.T) {
+		s, admin := newTestUsers(t)
+		user, _ := s.Register(ctx, RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+
+		if _, err := s.Ban(ctx, user, admin.Email, "", time.Time{}); err != ErrPermissionDenied {
+			t.Error("a user banned an admin", err)
+		}
+		if _, err := s.Ban(ctx, admin, user.Email, "", time.Now().Add(-time.Hour)); err != ErrBanInPast {
+			t.Error("ban ending in the past was accepted", err)
+		}
+		stale := WithPrecondition(ctx, func(u domain.User) bool { return u.Version == 0 })
+		if _, err := s.Ban(stale, admin, user.Email, "", time.Time{}); err != ErrPreconditionFailed {
+			t.Error("precondition was ignored", err)
+		}
+
+		until := time.Now().Add(time.Hour)
+		banned, err := s.Ban(ctx, admin, user.Email, "making mess", until)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !banned.Banned(time.Now()) || banned.Banned(until) || banned.Version != 2 {
+			t.Error("unexpected temporary ban", banned)
+		}
+		if event := banned.BanHistory[0]; event.Executor != admin.Email || event.Reason != "making mess" {
+			t.Error("unexpected history", event)
+		}
+
+		unbanned, err := s.Unban(ctx, admin, "Test@mail.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unbanned.Banned(time.Now()) || len(unbanned.BanHistory) != 2 {
+			t.Error("user is still banned", unbanned)
+		}
+	})
+
+	t.Run("change password", func(t *testing.T) {
+		s, _ := newTestUsers(t)
+		s.Register(ctx, RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+
+		var errs domain.FieldErrors
+		if _, err := s.ChangePassword(ctx, "test@mail.com", "cheesecake1"); !errors.As(err, &errs) {
+			t.Error("password with the favorite cake was accepted", err)
+		}
+		if _, err := s.ChangePassword(ctx, "test@mail.com", "newpassword"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Login(ctx, "test@mail.com", "newpassword"); err != nil {
+			t.Error("new password does not work", err)
+		}
+	})
+
+	t.Run("export and delete", func(t *testing.T) {
+		s, admin := newTestUsers(t)
+		s.SetDeletionGrace(time.Hour)
+		s.Register(ctx, RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		s.Ban(ctx, admin, "test@mail.com", "making mess", time.Time{})
+		s.Register(ctx, RegisterParams{Email: "deleted@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		s.Ban(ctx, admin, "deleted@mail.com", "making mess", time.Time{})
+		s.DeleteUser(ctx, admin, "deleted@mail.com")
+
+		export, err := s.Export(ctx, admin.Email)
+		if err != nil || len(export.AuditEntries) != 1 || export.AuditEntries[0].Target != "test@mail.com" {
+			t.Fatal("unexpected export", export, err)
+		}
+
+		if _, err := s.RequestDeletion(ctx, admin.Email, "wrong"); err != ErrInvalidCredentials {
+			t.Error("deletion without the password", err)
+		}
+		requested, err := s.RequestDeletion(ctx, admin.Email, "adminadmin")
+		if err != nil || time.Until(requested.DeleteAfter) <= 59*time.Minute {
+			t.Fatal("unexpected deletion", requested.DeleteAfter, err)
+		}
+		if canceled, err := s.CancelDeletion(ctx, admin.Email); err != nil || !canceled.DeleteAfter.IsZero() {
+			t.Error("deletion was not canceled", err)
+		}
+		requested, _ = s.RequestDeletion(ctx, admin.Email, "adminadmin")
+
+		if purged, err := s.PurgeDeleted(ctx, time.Now()); err != nil || len(purged) != 0 {
+			t.Error("purged during the grace period", purged, err)
+		}
+		purged, err := s.PurgeDeleted(ctx, requested.DeleteAfter)
+		if err != nil || len(purged) != 1 || purged[0] != admin.Email {
+			t.Fatal("unexpected purge", purged, err)
+		}
+		if _, err := s.Repository().Get(ctx, admin.Email); err == nil {
+			t.Error("user was not deleted")
+		}
+		user, _ := s.Repository().Get(ctx, "test@mail.com")
+		if executor := user.BanHistory[0].Executor; !strings.HasPrefix(executor, "deleted-user-") {
+			t.Error("ban record was not anonymized", executor)
+		}
+		tombstone, _ := s.Repository().GetDeleted(ctx, "deleted@mail.com")
+		if executor := tombstone.BanHistory[0].Executor; !strings.HasPrefix(executor, "deleted-user-") || !tombstone.Deleted() {
+			t.Error("ban record of a deleted user was not anonymized", executor)
+		}
+	})
+	t.Run("purges anonymize events and the webhook log", func(t *testing.T) {
+		s, admin := newTestUsers(t)
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		store, err := webhooks.NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := webhooks.NewDispatcher(store, nil, webhooks.DefaultRetryPolicy())
+		s.AddRecordKeeper(d)
+		if _, err := d.Subscribe(ctx, "https://crm.example.com/hook", "", events.Types); err != nil {
+			t.Fatal(err)
+		}
+
+		s.Register(ctx, RegisterParams{Email: "gone@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		s.Register(ctx, RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		gone, _ := s.Repository().Get(ctx, "gone@mail.com")
+		gone.Role = "AdminRole"
+		s.Repository().Update(ctx, gone.Email, gone)
+		gone, _ = s.Repository().Get(ctx, "gone@mail.com")
+		s.Ban(ctx, gone, "test@mail.com", "making mess", time.Time{})
+		s.Ban(ctx, admin, "gone@mail.com", "leaving", time.Time{})
+		s.Unban(ctx, admin, "gone@mail.com")
+		_, replay, _ := s.Events().Resume(0, func(events.Event) bool { return true })
+		for _, e := range replay {
+			d.Enqueue(ctx, e)
+		}
+
+		s.RequestDeletion(ctx, "gone@mail.com", "somepass")
+		if _, err := s.PurgeDeleted(ctx, time.Now().Add(DefaultDeletionGrace+time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil || strings.Contains(string(data), "gone@mail.com") || !strings.Contains(string(data), "test@mail.com") {
+			t.Error("email is still in the webhook log", string(data), err)
+		}
+		_, replay, _ = s.Events().Resume(0, func(events.Event) bool { return true })
+		for _, e := range replay {
+			if e.Email == "gone@mail.com" || e.Actor == "gone@mail.com" || e.PreviousEmail == "gone@mail.com" {
+				t.Error("email is still in the replay", e)
+			}
+		}
+		if last := replay[len(replay)-1]; last.Type != events.AccountClosed || !strings.HasPrefix(last.Email, "deleted-user-") {
+			t.Error("unexpected purge event", last)
+		}
+	})
+	t.Run("a cancel during the purge wins", func(t *testing.T) {
+		repo := &racingRepository{UserRepository: storage.FromLegacy(storage.NewInMemoryUserStorage())}
+		s := NewUsers(repo, nopMailer{}, domain.DefaultPasswordPolicy())
+		s.Register(ctx, RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		s.RequestDeletion(ctx, "test@mail.com", "somepass")
+
+		repo.afterGet = func() { s.CancelDeletion(ctx, "test@mail.com") }
+		purged, err := s.PurgeDeleted(ctx, time.Now().Add(DefaultDeletionGrace+time.Minute))
+		if err != nil || len(purged) != 0 {
+			t.Error("unexpected purge", purged, err)
+		}
+		if user, err := repo.Get(ctx, "test@mail.com"); err != nil || !user.DeleteAfter.IsZero() {
+			t.Error("the cancel was lost", user, err)
+		}
+	})
+	t.Run("purged users are revoked", func(t *testing.T) {
+		s, _ := newTestUsers(t)
+		for _, email := range []string{"first@mail.com", "second@mail.com", "third@mail.com"} {
+			s.Register(ctx, RegisterParams{Email: email, Password: "somepass", FavoriteCake: "cheesecake"})
+		}
+		s.RequestDeletion(ctx, "first@mail.com", "somepass")
+		s.RequestDeletion(ctx, "second@mail.com", "somepass")
+
+		r := &revoker{fail: map[string]bool{"first@mail.com": true}}
+		purged, err := s.PurgeDeletedAndRevoke(ctx, time.Now().Add(DefaultDeletionGrace+time.Minute), r)
+		if err == nil || !strings.Contains(err.Error(), "first@mail.com") {
+			t.Error("failed revocation was not reported", err)
+		}
+		if len(purged) != 2 || len(r.revoked) != 1 || r.revoked[0] != "second@mail.com" {
+			t.Error("unexpected purge", purged, r.revoked)
+		}
+		if _, err := s.Repository().Get(ctx, "third@mail.com"); err != nil {
+			t.Error("user without a deletion request was purged", err)
+		}
+	})
+	t.Run("delete, restore and purge", func(t *testing.T) {
+		s, admin := newTestUsers(t)
+		params := RegisterParams{Email: "test@mail.com", Password: "somepass", FavoriteCake: "cheesecake"}
+		s.Register(ctx, params)
+		user, _ := s.Repository().Get(ctx, "test@mail.com")
+
+		if _, err := s.DeleteUser(ctx, user, admin.Email); err != ErrPermissionDenied {
+			t.Error("user deleted an admin", err)
+		}
+		if _, err := s.DeleteUser(ctx, admin, admin.Email); err != ErrDeleteSelf {
+			t.Error("admin deleted itself", err)
+		}
+		deleted, err := s.DeleteUser(ctx, admin, "Test@mail.com")
+		if err != nil || deleted.DeletedBy != admin.Email || !deleted.Deleted() {
+			t.Fatal("unexpected deletion", deleted, err)
+		}
+		if _, err := s.Login(ctx, "test@mail.com", "somepass"); err == nil {
+			t.Error("deleted user logged in")
+		}
+		if _, err := s.Register(ctx, params); err != storage.ErrUserExists {
+			t.Error("email of a deleted user registered again", err)
+		}
+		s.Register(ctx, RegisterParams{Email: "other@mail.com", Password: "somepass", FavoriteCake: "cheesecake"})
+		if _, err := s.RequestEmailChange(ctx, "other@mail.com", "test@mail.com"); err != storage.ErrUserExists {
+			t.Error("email change to the email of a deleted user was requested", err)
+		}
+
+		if restored, err := s.RestoreUser(ctx, admin, "test@mail.com"); err != nil || restored.Deleted() {
+			t.Fatal("user was not restored", err)
+		}
+		if _, err := s.RestoreUser(ctx, admin, "test@mail.com"); err != storage.ErrNotDeleted {
+			t.Error("restored a user that is not deleted", err)
+		}
+		if _, err := s.PurgeUser(ctx, admin, "test@mail.com"); err != storage.ErrNotDeleted {
+			t.Error("purged a user that is not deleted", err)
+		}
+
+		s.DeleteUser(ctx, admin, "test@mail.com")
+		if purged, err := s.PurgeTombstones(ctx, time.Now().Add(-time.Hour)); err != nil || len(purged) != 0 {
+			t.Error("purged a recent tombstone", purged, err)
+		}
+		r := &revoker{}
+		purged, err := s.PurgeTombstonesAndRevoke(ctx, time.Now().Add(time.Minute), r)
+		if err != nil || len(purged) != 1 || purged[0] != "test@mail.com" {
+			t.Fatal("unexpected purge", purged, err)
+		}
+		if len(r.revoked) != 1 || r.revoked[0] != "test@mail.com" {
+			t.Error("purged tombstone was not revoked", r.revoked)
+		}
+		if _, err := s.Register(ctx, params); err != nil {
+			t.Error("email can't be registered after the purge", err)
+		}
+	})
+}
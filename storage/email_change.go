@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type EmailChange struct {
+	OldEmail string
+	NewEmail string
+	Expires  time.Time
+}
+
+type InMemoryEmailChangeStorage struct {
+	lock    sync.Mutex
+	changes map[string]EmailChange
+}
+
+func NewInMemoryEmailChangeStorage() *InMemoryEmailChangeStorage {
+	return &InMemoryEmailChangeStorage{
+		lock:    sync.Mutex{},
+		changes: make(map[string]EmailChange),
+	}
+}
+
+func (s *InMemoryEmailChangeStorage) Add(token string, change EmailChange) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.changes[token] = change
+}
+
+// Take returns the change for the token and forgets it, so every token
+// can be used only once.
+func (s *InMemoryEmailChangeStorage) Take(token string) (EmailChange, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	change, ok := s.changes[token]
+	if !ok {
+		return change, errors.New("invalid confirmation token")
+	}
+	delete(s.changes, token)
+	if time.Now().After(change.Expires) {
+		return change, errors.New("confirmation token expired")
+	}
+	return change, nil
+}
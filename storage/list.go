@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"golang-api/domain"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// UserFilter describes which users List returns. Empty fields match everything.
+type UserFilter struct {
+	Role          string
+	Banned        *bool
+	EmailPrefix   string
+	EmailContains string
+	FavoriteCake  string
+	// Deleted lists the tombstones of deleted users instead of the users.
+	Deleted bool
+}
+
+// Page asks for at most Limit users after the position stored in Cursor.
+// Cursor is empty for the first page.
+type Page struct {
+	Cursor string
+	Limit  int
+}
+
+// UserPage holds users ordered by email. NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []domain.User
+	NextCursor string
+}
+
+func (f UserFilter) Match(u domain.User) bool {
+	role := u.EffectiveRole()
+	email := strings.ToLower(u.Email)
+	switch {
+	case f.Deleted != u.Deleted():
+		return false
+	case f.Role != "" && f.Role != role:
+		return false
+	case f.Banned != nil && *f.Banned != u.Banned(time.Now()):
+		return false
+	case f.EmailPrefix != "" && !strings.HasPrefix(email, strings.ToLower(f.EmailPrefix)):
+		return false
+	case f.EmailContains != "" && !strings.Contains(email, strings.ToLower(f.EmailContains)):
+		return false
+	case f.FavoriteCake != "" && !strings.EqualFold(f.FavoriteCake, u.FavoriteCake):
+		return false
+	}
+	return true
+}
+
+func (p Page) limit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+// Cursors are opaque for clients, inside they are the last key of the page.
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.New("invalid cursor")
+	}
+	return string(key), nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+
+	"golang-api/domain"
+)
+
+// EmailMigration is the result of MigrateEmails.
+type EmailMigration struct {
+	// Renamed maps old keys to their canonical form.
+	Renamed map[string]string
+	// Collisions maps a canonical email to the keys that share it.
+	// Such users are left untouched and have to be merged by hand.
+	Collisions map[string][]string
+	// Invalid keys can't be normalized at all.
+	Invalid []string
+}
+
+// MigrateEmails renames users stored under non canonical keys. Keys that
+// would end up as the same email are only reported.
+func MigrateEmails(ctx context.Context, users UserRepository, n domain.EmailNormalizer) (EmailMigration, error) {
+	result := EmailMigration{
+		Renamed:    make(map[string]string),
+		Collisions: make(map[string][]string),
+	}
+	groups := make(map[string][]string)
+	page := Page{Limit: MaxPageLimit}
+	for {
+		list, err := users.List(ctx, UserFilter{}, page)
+		if err != nil {
+			return result, err
+		}
+		for _, u := range list.Users {
+			email, err := n.Normalize(u.Email)
+			if err != nil {
+				result.Invalid = append(result.Invalid, u.Email)
+				continue
+			}
+			groups[email] = append(groups[email], u.Email)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		page.Cursor = list.NextCursor
+	}
+
+	for email, keys := range groups {
+		if len(keys) > 1 {
+			result.Collisions[email] = keys
+			continue
+		}
+		if keys[0] == email {
+			continue
+		}
+		if err := users.Rename(ctx, keys[0], email); err != nil {
+			return result, err
+		}
+		result.Renamed[keys[0]] = email
+	}
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"golang-api/domain"
+)
+
+func TestMigrateEmails(t *testing.T) {
+	users := FromLegacy(NewInMemoryUserStorage())
+	ctx := context.Background()
+	for _, email := range []string{"Test@mail.com", "test@MAIL.com", "Cake@Mail.com", "ok@mail.com", "Name <x@mail.com>"} {
+		users.Add(ctx, email, domain.User{Email: email})
+	}
+
+	result, err := MigrateEmails(ctx, users, domain.EmailNormalizer{FoldLocalCase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Collisions["test@mail.com"]) != 2 {
+		t.Error("collision was not detected", result.Collisions)
+	}
+	if result.Renamed["Cake@Mail.com"] != "cake@mail.com" || len(result.Renamed) != 1 {
+		t.Error("unexpected renames", result.Renamed)
+	}
+	if len(result.Invalid) != 1 {
+		t.Error("invalid email was not reported", result.Invalid)
+	}
+	if _, err := users.Get(ctx, "cake@mail.com"); err != nil {
+		t.Error("user was not renamed")
+	}
+	if _, err := users.Get(ctx, "Test@mail.com"); err != nil {
+		t.Error("colliding user was touched")
+	}
+}
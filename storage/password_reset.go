@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// PasswordReset is a pending reset. Version is the version of the user
+// when the reset was requested, any change of the user makes it invalid.
+type PasswordReset struct {
+	Email   string
+	Version int
+	Expires time.Time
+}
+
+type InMemoryPasswordResetStorage struct {
+	lock   sync.Mutex
+	resets map[string]PasswordReset
+}
+
+func NewInMemoryPasswordResetStorage() *InMemoryPasswordResetStorage {
+	return &InMemoryPasswordResetStorage{
+		lock:   sync.Mutex{},
+		resets: make(map[string]PasswordReset),
+	}
+}
+
+func (s *InMemoryPasswordResetStorage) Add(token string, reset PasswordReset) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.resets[token] = reset
+}
+
+// Take returns the reset for the token and forgets it, so every token
+// can be used only once.
+func (s *InMemoryPasswordResetStorage) Take(token string) (PasswordReset, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	reset, ok := s.resets[token]
+	if !ok {
+		return reset, errors.New("invalid reset token")
+	}
+	delete(s.resets, token)
+	if time.Now().After(reset.Expires) {
+		return reset, errors.New("reset token expired")
+	}
+	return reset, nil
+}
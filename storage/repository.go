@@ -0,0 +1,47 @@
+// Package storage has the user repository interface, its in-memory
+// implementation and the stores of pending email changes and password
+// resets.
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"golang-api/domain"
+)
+
+var (
+	ErrVersionConflict = errors.New("user was modified by another request")
+	ErrUserExists      = errors.New("user with same login already exists")
+	ErrNotDeleted      = errors.New("user is not deleted")
+)
+
+type UserRepository interface {
+	Add(context.Context, string, domain.User) error
+	Get(context.Context, string) (domain.User, error)
+	Update(context.Context, string, domain.User) error
+	// CompareAndUpdate works like Update but only when the stored user
+	// still has the given version, otherwise ErrVersionConflict is returned.
+	CompareAndUpdate(context.Context, string, int, domain.User) error
+	Delete(context.Context, string) (domain.User, error)
+	// CompareAndDelete works like Delete but only when the stored user
+	// or tombstone still has the given version, otherwise
+	// ErrVersionConflict is returned.
+	CompareAndDelete(context.Context, string, int) (domain.User, error)
+	// Rename moves a user to a new key keeping all of its fields.
+	// It has to be atomic, SQL backends should do it in one transaction.
+	Rename(context.Context, string, string) error
+	// List returns one page of users matching the filter ordered by key.
+	// SQL backends are expected to use keyset pagination on the key.
+	List(context.Context, UserFilter, Page) (UserPage, error)
+	// Deleted users stay as tombstones: the other methods treat them as
+	// missing, but Add still refuses their key. GetDeleted reads a
+	// tombstone and Restore turns it back into a user, both return
+	// ErrNotDeleted for users that are not deleted. Delete removes
+	// users and tombstones for good.
+	GetDeleted(context.Context, string) (domain.User, error)
+	Restore(context.Context, string) (domain.User, error)
+	// CompareAndUpdateDeleted is CompareAndUpdate for tombstones, the
+	// user stays deleted whatever the new value says.
+	CompareAndUpdateDeleted(context.Context, string, int, domain.User) error
+}
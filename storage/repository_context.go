@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"golang-api/domain"
+)
+
+const defaultStorageTimeout = 2 * time.Second
+
+// LegacyUserRepository is the repository API without contexts.
+// Wrap such implementations with FromLegacy to use them in handlers.
+type LegacyUserRepository interface {
+	Add(string, domain.User) error
+	Get(string) (domain.User, error)
+	Update(string, domain.User) error
+	CompareAndUpdate(string, int, domain.User) error
+	Delete(string) (domain.User, error)
+	CompareAndDelete(string, int) (domain.User, error)
+	Rename(string, string) error
+	List(context.Context, UserFilter, Page) (UserPage, error)
+	GetDeleted(string) (domain.User, error)
+	Restore(string) (domain.User, error)
+	CompareAndUpdateDeleted(string, int, domain.User) error
+}
+
+// FromLegacy adapts a repository without context support. Calls can't be
+// interrupted once started, so the context is only checked before the call.
+func FromLegacy(repo LegacyUserRepository) UserRepository {
+	return legacyUserRepository{repo: repo}
+}
+
+type legacyUserRepository struct {
+	repo LegacyUserRepository
+}
+
+func (l legacyUserRepository) Add(ctx context.Context, key string, u domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.repo.Add(key, u)
+}
+
+func (l legacyUserRepository) Get(ctx context.Context, key string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+	return l.repo.Get(key)
+}
+
+func (l legacyUserRepository) Update(ctx context.Context, key string, u domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.repo.Update(key, u)
+}
+
+func (l legacyUserRepository) CompareAndUpdate(ctx context.Context, key string, version int, u domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.repo.CompareAndUpdate(key, version, u)
+}
+
+func (l legacyUserRepository) Delete(ctx context.Context, key string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+	return l.repo.Delete(key)
+}
+
+func (l legacyUserRepository) CompareAndDelete(ctx context.Context, key string, version int) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+	return l.repo.CompareAndDelete(key, version)
+}
+
+func (l legacyUserRepository) Rename(ctx context.Context, oldKey, newKey string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.repo.Rename(oldKey, newKey)
+}
+
+func (l legacyUserRepository) List(ctx context.Context, filter UserFilter, page Page) (UserPage, error) {
+	return l.repo.List(ctx, filter, page)
+}
+
+func (l legacyUserRepository) GetDeleted(ctx context.Context, key string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+	return l.repo.GetDeleted(key)
+}
+
+func (l legacyUserRepository) Restore(ctx context.Context, key string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+	return l.repo.Restore(key)
+}
+
+func (l legacyUserRepository) CompareAndUpdateDeleted(ctx context.Context, key string, version int, u domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.repo.CompareAndUpdateDeleted(key, version, u)
+}
+
+// WithTimeout gives every call to the repository its own deadline.
+func WithTimeout(repo UserRepository, timeout time.Duration) UserRepository {
+	return timeoutUserRepository{repo: repo, timeout: timeout}
+}
+
+type timeoutUserRepository struct {
+	repo    UserRepository
+	timeout time.Duration
+}
+
+func (t timeoutUserRepository) Add(ctx context.Context, key string, u domain.User) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.Add(ctx, key, u)
+}
+
+func (t timeoutUserRepository) Get(ctx context.Context, key string) (domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.Get(ctx, key)
+}
+
+func (t timeoutUserRepository) Update(ctx context.Context, key string, u domain.User) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.Update(ctx, key, u)
+}
+
+func (t timeoutUserRepository) CompareAndUpdate(ctx context.Context, key string, version int, u domain.User) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.CompareAndUpdate(ctx, key, version, u)
+}
+
+func (t timeoutUserRepository) Delete(ctx context.Context, key string) (domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.Delete(ctx, key)
+}
+
+func (t timeoutUserRepository) CompareAndDelete(ctx context.Context, key string, version int) (domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.CompareAndDelete(ctx, key, version)
+}
+
+func (t timeoutUserRepository) Rename(ctx context.Context, oldKey, newKey string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.Rename(ctx, oldKey, newKey)
+}
+
+func (t timeoutUserRepository) List(ctx context.Context, filter UserFilter, page Page) (UserPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.List(ctx, filter, page)
+}
+
+func (t timeoutUserRepository) GetDeleted(ctx context.Context, key string) (domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.GetDeleted(ctx, key)
+}
+
+func (t timeoutUserRepository) Restore(ctx context.Context, key string) (domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.Restore(ctx, key)
+}
+
+func (t timeoutUserRepository) CompareAndUpdateDeleted(ctx context.Context, key string, version int, u domain.User) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.repo.CompareAndUpdateDeleted(ctx, key, version, u)
+}
+
+// TimeoutFromEnv reads the per-call deadline from CAKE_STORAGE_TIMEOUT,
+// e.g. "500ms" or "3s".
+func TimeoutFromEnv() (time.Duration, error) {
+	value := os.Getenv("CAKE_STORAGE_TIMEOUT")
+	if value == "" {
+		return defaultStorageTimeout, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	//"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-api/domain"
+)
+
+type InMemoryUserStorage struct {
+	lock    sync.RWMutex
+	storage map[string]domain.User
+}
+
+func NewInMemoryUserStorage() *InMemoryUserStorage {
+	return &InMemoryUserStorage{
+		lock:    sync.RWMutex{},
+		storage: make(map[string]domain.User),
+	}
+}
+
+func (repo *InMemoryUserStorage) Add(login string, userNew domain.User) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	_, ok := repo.storage[login]
+	if ok {
+		return ErrUserExists
+	}
+
+	userNew.Version = 1
+	repo.storage[login] = userNew
+
+	return nil
+}
+func (repo *InMemoryUserStorage) Update(login string, userN domain.User) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	old, ok := repo.storage[login]
+	if !ok || old.Deleted() {
+		return errors.New(" there is no such user to update ")
+	}
+	userN.Version = old.Version + 1
+	repo.storage[login] = userN
+	return nil
+}
+
+func (repo *InMemoryUserStorage) CompareAndUpdate(login string, version int, userN domain.User) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	old, ok := repo.storage[login]
+	if !ok || old.Deleted() {
+		return errors.New(" there is no such user to update ")
+	}
+	if old.Version != version {
+		return ErrVersionConflict
+	}
+	userN.Version = version + 1
+	repo.storage[login] = userN
+	return nil
+}
+
+func (repo *InMemoryUserStorage) Get(login string) (domain.User, error) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+	getUser, ok := repo.storage[login]
+	if !ok || getUser.Deleted() {
+		return domain.User{}, errors.New("invalid login params")
+	}
+	return getUser, nil
+}
+
+func (repo *InMemoryUserStorage) GetDeleted(login string) (domain.User, error) {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+	user, ok := repo.storage[login]
+	if !ok {
+		return user, errors.New("user does not exist")
+	}
+	if !user.Deleted() {
+		return domain.User{}, ErrNotDeleted
+	}
+	return user, nil
+}
+
+func (repo *InMemoryUserStorage) Restore(login string) (domain.User, error) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+	user, ok := repo.storage[login]
+	if !ok {
+		return user, errors.New("user does not exist")
+	}
+	if !user.Deleted() {
+		return domain.User{}, ErrNotDeleted
+	}
+	user.DeletedAt = time.Time{}
+	user.DeletedBy = ""
+	user.Version++
+	repo.storage[login] = user
+	return user, nil
+}
+
+func (repo *InMemoryUserStorage) CompareAndUpdateDeleted(login string, version int, userN domain.User) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	old, ok := repo.storage[login]
+	if !ok {
+		return errors.New("user does not exist")
+	}
+	if !old.Deleted() {
+		return ErrNotDeleted
+	}
+	if old.Version != version {
+		return ErrVersionConflict
+	}
+	userN.DeletedAt = old.DeletedAt
+	userN.DeletedBy = old.DeletedBy
+	userN.Version = version + 1
+	repo.storage[login] = userN
+	return nil
+}
+
+func (repo *InMemoryUserStorage) List(ctx context.Context, filter UserFilter, page Page) (UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return UserPage{}, err
+	}
+	after := ""
+	if page.Cursor != "" {
+		key, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return UserPage{}, err
+		}
+		after = key
+	}
+
+	repo.lock.RLock()
+	keys := make([]string, 0, len(repo.storage))
+	for key, u := range repo.storage {
+		if key > after && filter.Match(u) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := UserPage{}
+	limit := page.limit()
+	if len(keys) > limit {
+		keys = keys[:limit]
+		result.NextCursor = encodeCursor(keys[limit-1])
+	}
+	result.Users = make([]domain.User, 0, len(keys))
+	for _, key := range keys {
+		result.Users = append(result.Users, repo.storage[key])
+	}
+	repo.lock.RUnlock()
+
+	return result, nil
+}
+
+func (user *InMemoryUserStorage) Delete(key string) (domain.User, error) {
+	user.lock.Lock()
+	defer user.lock.Unlock()
+
+	name, ok := user.storage[key]
+	if !ok {
+		return name, errors.New("user does not exist")
+	}
+
+	delete(user.storage, key)
+	return name, nil
+}
+
+func (repo *InMemoryUserStorage) CompareAndDelete(login string, version int) (domain.User, error) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	user, ok := repo.storage[login]
+	if !ok {
+		return user, errors.New("user does not exist")
+	}
+	if user.Version != version {
+		return domain.User{}, ErrVersionConflict
+	}
+	delete(repo.storage, login)
+	return user, nil
+}
+
+func (repo *InMemoryUserStorage) Rename(oldLogin, newLogin string) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	user, ok := repo.storage[oldLogin]
+	if !ok || user.Deleted() {
+		return errors.New("user does not exist")
+	}
+	if _, ok := repo.storage[newLogin]; ok {
+		return ErrUserExists
+	}
+
+	user.Email = newLogin
+	user.Version++
+	repo.storage[newLogin] = user
+	delete(repo.storage, oldLogin)
+	return nil
+}
+
+// Add should return error if user with given key (login) is already present
+// Update should return error if there is no such user to update
+// Delete should return error if there is no such user to delete
+// Delete should return deleted user
+// CompareAndUpdate should return ErrVersionConflict if the stored version differs
+// CompareAndDelete should return ErrVersionConflict if the stored version differs
+// List should return users sorted by login, a page starts right after the cursor
+// Rename should return error if there is no such user or the new key is taken
+// Rename should keep every field of the user except the email
+// Get, Update, CompareAndUpdate and Rename should treat deleted users as missing
+// Add and Rename should refuse the key of a deleted user until it is deleted for good
+// Restore should return ErrNotDeleted if the user is not deleted
+// CompareAndUpdateDeleted should return ErrNotDeleted if the user is not deleted
+// CompareAndUpdateDeleted should keep the user deleted
@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"golang-api/domain"
+)
+
+func TestUser_repository(t *testing.T) {
+	t.Run("add user", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		email := "test@gmail.com"
+		user := domain.User{
+			Email:          email,
+			PasswordDigest: "testtest",
+			FavoriteCake:   "testtest",
+		}
+		ok := users.Add(email, user)
+		ok2 := users.Add(email, user)
+		if !(ok == nil && ok2 != nil) {
+			t.Error("you have added the same user again ")
+		}
+
+	})
+	t.Run("delete user", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		email := "test@gmail.com"
+		user := domain.User{
+			Email:          email,
+			PasswordDigest: "testtest",
+			FavoriteCake:   "testtest",
+		}
+		users.Add(email, user)
+		users.Delete(email)
+		_, ok := users.Delete(email)
+		if ok == nil {
+			t.Error("user doesn`t exist")
+		}
+
+	})
+	t.Run("compare and delete user", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		email := "test@gmail.com"
+		users.Add(email, domain.User{Email: email})
+		stored, _ := users.Get(email)
+		users.Update(email, stored)
+		if _, err := users.CompareAndDelete(email, stored.Version); err != ErrVersionConflict {
+			t.Error("you have deleted a user with a stale version", err)
+		}
+		if _, err := users.CompareAndDelete(email, stored.Version+1); err != nil {
+			t.Error(err)
+		}
+		if _, err := users.Get(email); err == nil {
+			t.Error("user was not deleted")
+		}
+	})
+	t.Run("update user", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		email := "test@gmail.com"
+		user := domain.User{
+			Email:          email,
+			PasswordDigest: "testtest",
+			FavoriteCake:   "testtest",
+		}
+		user2 := domain.User{
+			Email:          email,
+			PasswordDigest: "UPdateduser",
+			FavoriteCake:   "UPdateduser",
+		}
+		user3 := domain.User{
+			Email:          "@gmail.com",
+			PasswordDigest: "UPdateduser",
+			FavoriteCake:   "UPdateduser",
+		}
+
+		users.Add(email, user)
+		ok2 := users.Update(email, user2)
+		if ok2 != nil {
+			t.Error("you can`t update user by this email ")
+		}
+		ok2 = users.Update("gmail.com", user3)
+	})
+	t.Run("compare and update user", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		email := "test@gmail.com"
+		user := domain.User{
+			Email:          email,
+			PasswordDigest: "testtest",
+			FavoriteCake:   "testtest",
+		}
+		users.Add(email, user)
+		stored, _ := users.Get(email)
+
+		first := stored
+		first.FavoriteCake = "first"
+		second := stored
+		second.FavoriteCake = "second"
+
+		if err := users.CompareAndUpdate(email, stored.Version, first); err != nil {
+			t.Error("you can`t update user with actual version", err)
+		}
+		if err := users.CompareAndUpdate(email, stored.Version, second); err != ErrVersionConflict {
+			t.Error("you have overwritten user with stale version")
+		}
+		updated, _ := users.Get(email)
+		if updated.FavoriteCake != "first" || updated.Version != stored.Version+1 {
+			t.Error("lost update", updated)
+		}
+	})
+	t.Run("rename user", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		email := "test@gmail.com"
+		user := domain.User{
+			Email:          email,
+			PasswordDigest: "testtest",
+			FavoriteCake:   "testtest",
+			Role:           "AdminRole",
+			Ban:            true,
+			BanHistory:     domain.History{{Executor: "admin@gmail.com", IsBan: true}},
+		}
+		users.Add(email, user)
+		users.Add("taken@gmail.com", user)
+
+		if err := users.Rename(email, "taken@gmail.com"); err == nil {
+			t.Error("you have renamed user to an existing login")
+		}
+		if err := users.Rename("missing@gmail.com", "new@gmail.com"); err == nil {
+			t.Error("you have renamed user that doesn`t exist")
+		}
+		if err := users.Rename(email, "new@gmail.com"); err != nil {
+			t.Error("you can`t rename user", err)
+		}
+		if _, err := users.Get(email); err == nil {
+			t.Error("old login still exists")
+		}
+		renamed, err := users.Get("new@gmail.com")
+		if err != nil {
+			t.Error("renamed user doesn`t exist")
+		}
+		if renamed.Email != "new@gmail.com" || renamed.Role != "AdminRole" ||
+			!renamed.Ban || len(renamed.BanHistory) != 1 {
+			t.Error("user fields were lost on rename")
+		}
+	})
+	t.Run("list users", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		for _, email := range []string{"d@gmail.com", "a@gmail.com", "c@mail.com", "b@gmail.com"} {
+			users.Add(email, domain.User{Email: email, FavoriteCake: "cheesecake"})
+		}
+		banned, _ := users.Get("b@gmail.com")
+		banned.Ban = true
+		users.Update(banned.Email, banned)
+		users.Add("e@gmail.com", domain.User{Email: "e@gmail.com", FavoriteCake: "muffin", Role: "AdminRole"})
+
+		var emails []string
+		page := Page{Limit: 2}
+		for {
+			result, err := users.List(context.Background(), UserFilter{}, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range result.Users {
+				emails = append(emails, u.Email)
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			page.Cursor = result.NextCursor
+		}
+		if len(emails) != 5 || emails[0] != "a@gmail.com" || emails[4] != "e@gmail.com" {
+			t.Error("pages are not stable", emails)
+		}
+
+		isBanned := true
+		filters := map[string]UserFilter{
+			"b@gmail.com": {Banned: &isBanned},
+			"c@mail.com":  {EmailContains: "@mail."},
+			"e@gmail.com": {Role: "AdminRole", EmailPrefix: "E", FavoriteCake: "muffin"},
+		}
+		for expected, filter := range filters {
+			result, _ := users.List(context.Background(), filter, Page{})
+			if len(result.Users) != 1 || result.Users[0].Email != expected {
+				t.Error("unexpected users for filter", filter, result.Users)
+			}
+		}
+
+		if _, err := users.List(context.Background(), UserFilter{}, Page{Cursor: "%%%"}); err == nil {
+			t.Error("invalid cursor accepted")
+		}
+	})
+	t.Run("soft delete user", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		email := "test@gmail.com"
+		users.Add(email, domain.User{Email: email, FavoriteCake: "testtest"})
+		users.Add("other@gmail.com", domain.User{Email: "other@gmail.com"})
+		stored, _ := users.Get(email)
+
+		deleted := stored
+		deleted.DeletedAt = time.Now()
+		deleted.DeletedBy = "admin@gmail.com"
+		if err := users.CompareAndUpdate(email, stored.Version, deleted); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.Get(email); err == nil {
+			t.Error("deleted user is visible")
+		}
+		if err := users.Add(email, domain.User{Email: email}); err != ErrUserExists {
+			t.Error("you have added a user over a tombstone")
+		}
+		if err := users.Rename("other@gmail.com", email); err != ErrUserExists {
+			t.Error("you have renamed a user over a tombstone")
+		}
+		result, _ := users.List(context.Background(), UserFilter{Deleted: true}, Page{})
+		if len(result.Users) != 1 || result.Users[0].Email != email {
+			t.Error("unexpected tombstones", result.Users)
+		}
+		if _, err := users.Restore("other@gmail.com"); err != ErrNotDeleted {
+			t.Error("you have restored a user that is not deleted")
+		}
+
+		tombstone, _ := users.GetDeleted(email)
+		changed := tombstone
+		changed.FavoriteCake = "changed"
+		changed.DeletedAt = time.Time{}
+		if err := users.CompareAndUpdateDeleted(email, tombstone.Version-1, changed); err != ErrVersionConflict {
+			t.Error("you have updated a tombstone with a stale version", err)
+		}
+		if err := users.CompareAndUpdateDeleted("other@gmail.com", 1, changed); err != ErrNotDeleted {
+			t.Error("you have updated a user that is not deleted as a tombstone", err)
+		}
+		if err := users.CompareAndUpdateDeleted(email, tombstone.Version, changed); err != nil {
+			t.Fatal(err)
+		}
+		if tombstone, err := users.GetDeleted(email); err != nil || tombstone.FavoriteCake != "changed" {
+			t.Error("tombstone was not updated", tombstone, err)
+		}
+		changed.FavoriteCake = "testtest"
+		if err := users.CompareAndUpdateDeleted(email, tombstone.Version+1, changed); err != nil {
+			t.Fatal(err)
+		}
+
+		restored, err := users.Restore(email)
+		if err != nil || restored.Deleted() || restored.FavoriteCake != "testtest" {
+			t.Fatal("user was not restored", restored, err)
+		}
+		if _, err := users.Get(email); err != nil {
+			t.Error("restored user is not visible")
+		}
+	})
+	t.Run("get user", func(t *testing.T) {
+		users := NewInMemoryUserStorage()
+		email := "test@gmail.com"
+		user := domain.User{
+			Email:          email,
+			PasswordDigest: "testtest",
+			FavoriteCake:   "testtest",
+		}
+		users.Add(email, user)
+		user2, ok := users.Get(email)
+		if ok != nil {
+			t.Error("user dosen`t exist")
+		}
+		if user2.FavoriteCake == "" && user2.PasswordDigest == "" {
+			t.Error("users fields is empty")
+		}
+
+	})
+
+}
+
+type deadlineRepository struct {
+	LegacyUserRepository
+	deadline time.Time
+}
+
+func (d *deadlineRepository) List(ctx context.Context, filter UserFilter, page Page) (UserPage, error) {
+	d.deadline, _ = ctx.Deadline()
+	return UserPage{}, ctx.Err()
+}
+
+func TestUser_repository_context(t *testing.T) {
+	t.Run("canceled context", func(t *testing.T) {
+		users := FromLegacy(NewInMemoryUserStorage())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := users.Add(ctx, "test@gmail.com", domain.User{Email: "test@gmail.com"})
+		if err != context.Canceled {
+			t.Error("canceled context was ignored")
+		}
+		if _, err := users.Get(context.Background(), "test@gmail.com"); err == nil {
+			t.Error("user was added with canceled context")
+		}
+	})
+	t.Run("per call timeout", func(t *testing.T) {
+		legacy := &deadlineRepository{LegacyUserRepository: NewInMemoryUserStorage()}
+		users := WithTimeout(FromLegacy(legacy), time.Minute)
+
+		started := time.Now()
+		users.List(context.Background(), UserFilter{}, Page{})
+		if legacy.deadline.IsZero() || legacy.deadline.After(started.Add(2*time.Minute)) {
+			t.Error("call has no deadline", legacy.deadline)
+		}
+	})
+	t.Run("timeout from env", func(t *testing.T) {
+		os.Setenv("CAKE_STORAGE_TIMEOUT", "150ms")
+		defer os.Unsetenv("CAKE_STORAGE_TIMEOUT")
+		timeout, err := TimeoutFromEnv()
+		if err != nil || timeout != 150*time.Millisecond {
+			t.Error("unexpected timeout", timeout, err)
+		}
+	})
+}
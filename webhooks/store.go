@@ -0,0 +1,463 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-api/events"
+)
+
+// Statuses of deliveries.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound     = errors.New("webhook delivery not found")
+)
+
+// Subscription sends the events of the listed types to URL, signed with
+// Secret.
+type Subscription struct {
+	ID      string    `json:"id"`
+	URL     string    `json:"url"`
+	Secret  string    `json:"secret"`
+	Events  []string  `json:"events"`
+	Created time.Time `json:"created"`
+}
+
+func (s Subscription) Wants(eventType string) bool {
+	for _, t := range s.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event on its way to one subscription. Pending
+// deliveries are retried at NextAttempt until they succeed or run out of
+// attempts. Finished deliveries stay in the log with the whole event
+// until Prune removes them, Anonymize replaces the email of purged users
+// in them.
+type Delivery struct {
+	ID             string       `json:"id"`
+	SubscriptionID string       `json:"subscription_id"`
+	Event          events.Event `json:"event"`
+	Status         string       `json:"status"`
+	Attempts       []Attempt    `json:"attempts"`
+	NextAttempt    time.Time    `json:"next_attempt"`
+	Created        time.Time    `json:"created"`
+}
+
+// finished is the time of the last attempt, deliveries without attempts
+// count from their creation.
+func (d Delivery) finished() time.Time {
+	if len(d.Attempts) == 0 {
+		return d.Created
+	}
+	return d.Attempts[len(d.Attempts)-1].Time
+}
+
+// Attempt is one request of a delivery. StatusCode is 0 when there was
+// no response, Error says why.
+type Attempt struct {
+	Time       time.Time     `json:"time"`
+	StatusCode int           `json:"status_code"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Manual     bool          `json:"manual,omitempty"`
+}
+
+type Store interface {
+	AddSubscription(context.Context, Subscription) error
+	Subscription(context.Context, string) (Subscription, error)
+	Subscriptions(context.Context) ([]Subscription, error)
+	// RemoveSubscription also drops the pending deliveries of it, the
+	// finished ones stay in the log.
+	RemoveSubscription(context.Context, string) error
+	AddDelivery(context.Context, Delivery) error
+	// UpdateDelivery changes the status and the attempts of a delivery,
+	// the event stays as stored.
+	UpdateDelivery(context.Context, Delivery) error
+	Delivery(context.Context, string) (Delivery, error)
+	// Deliveries returns the log of a subscription, the newest first.
+	Deliveries(context.Context, string) ([]Delivery, error)
+	// Due returns the pending deliveries to attempt at now, the oldest first.
+	Due(context.Context, time.Time) ([]Delivery, error)
+	// Anonymize replaces an email with alias in the events of all
+	// deliveries.
+	Anonymize(ctx context.Context, email, alias string) error
+	// Prune removes the finished deliveries whose last attempt was
+	// before the given time and returns how many there were.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+type InMemoryStore struct {
+	lock          sync.RWMutex
+	subscriptions map[string]Subscription
+	deliveries    map[string]Delivery
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		lock:          sync.RWMutex{},
+		subscriptions: make(map[string]Subscription),
+		deliveries:    make(map[string]Delivery),
+	}
+}
+
+func (s *InMemoryStore) AddSubscription(ctx context.Context, sub Subscription) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.subscriptions[sub.ID]; ok {
+		return errors.New("webhook subscription already exists")
+	}
+	s.subscriptions[sub.ID] = sub
+	return nil
+}
+
+func (s *InMemoryStore) Subscription(ctx context.Context, id string) (Subscription, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return sub, ErrSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+func (s *InMemoryStore) Subscriptions(ctx context.Context) ([]Subscription, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	subs := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Created.Before(subs[j].Created) })
+	return subs, nil
+}
+
+func (s *InMemoryStore) RemoveSubscription(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.subscriptions[id]; !ok {
+		return ErrSubscriptionNotFound
+	}
+	delete(s.subscriptions, id)
+	for deliveryID, d := range s.deliveries {
+		if d.SubscriptionID == id && d.Status == StatusPending {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStore) AddDelivery(ctx context.Context, d Delivery) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.deliveries[d.ID]; ok {
+		return errors.New("webhook delivery already exists")
+	}
+	s.deliveries[d.ID] = d
+	return nil
+}
+
+func (s *InMemoryStore) UpdateDelivery(ctx context.Context, d Delivery) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	old, ok := s.deliveries[d.ID]
+	if !ok {
+		return ErrDeliveryNotFound
+	}
+	// it may have been anonymized while the delivery was sent
+	d.Event = old.Event
+	s.deliveries[d.ID] = d
+	return nil
+}
+
+func (s *InMemoryStore) Delivery(ctx context.Context, id string) (Delivery, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	d, ok := s.deliveries[id]
+	if !ok {
+		return d, ErrDeliveryNotFound
+	}
+	return d, nil
+}
+
+func (s *InMemoryStore) Deliveries(ctx context.Context, subscriptionID string) ([]Delivery, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]Delivery, 0)
+	for _, d := range s.deliveries {
+		if d.SubscriptionID == subscriptionID {
+			result = append(result, d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return byAge(result[j], result[i]) })
+	return result, nil
+}
+
+func (s *InMemoryStore) Due(ctx context.Context, now time.Time) ([]Delivery, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]Delivery, 0)
+	for _, d := range s.deliveries {
+		if d.Status == StatusPending && !d.NextAttempt.After(now) {
+			result = append(result, d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return byAge(result[i], result[j]) })
+	return result, nil
+}
+
+func (s *InMemoryStore) Anonymize(ctx context.Context, email, alias string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, d := range s.deliveries {
+		d.Event = d.Event.Anonymize(email, alias)
+		s.deliveries[id] = d
+	}
+	return nil
+}
+
+func (s *InMemoryStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n := 0
+	for id, d := range s.deliveries {
+		if d.Status != StatusPending && d.finished().Before(before) {
+			delete(s.deliveries, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// byAge orders deliveries by creation, the event ID breaks ties of
+// deliveries made at the same time.
+func byAge(a, b Delivery) bool {
+	if !a.Created.Equal(b.Created) {
+		return a.Created.Before(b.Created)
+	}
+	if a.Event.ID != b.Event.ID {
+		return a.Event.ID < b.Event.ID
+	}
+	return a.ID < b.ID
+}
+
+// FileStore is an InMemoryStore that keeps a journal of its changes in a
+// file, so the queue survives restarts. Every change appends one entry,
+// the file is rewritten from the store when it is opened, when the
+// journal grew much longer than the store, and when records have to be
+// gone from it: after Anonymize and Prune.
+type FileStore struct {
+	*InMemoryStore
+	path string
+	// lock orders the writes of the file with the changes
+	lock sync.Mutex
+	// entries is the number of entries appended since the last rewrite
+	entries int
+}
+
+// compactAfter is how many entries the journal may have beyond the
+// records of the store before it is rewritten.
+const compactAfter = 1000
+
+// fileEntry is an entry of the journal. Subscriptions and deliveries
+// are stored as they are now, removed subscriptions take their pending
+// deliveries with them like RemoveSubscription does. A rewritten file is
+// a single entry with the whole store.
+type fileEntry struct {
+	Subscriptions        []Subscription `json:"subscriptions,omitempty"`
+	Deliveries           []Delivery     `json:"deliveries,omitempty"`
+	RemovedSubscriptions []string       `json:"removed_subscriptions,omitempty"`
+}
+
+// NewFileStore loads the store from path, a missing file is an empty store.
+// An entry cut short by a crash is dropped.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{InMemoryStore: NewInMemoryStore(), path: path}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		entry := fileEntry{}
+		err := dec.Decode(&entry)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.apply(entry)
+	}
+	return s, s.rewrite()
+}
+
+func (s *FileStore) apply(entry fileEntry) {
+	for _, sub := range entry.Subscriptions {
+		s.subscriptions[sub.ID] = sub
+	}
+	for _, d := range entry.Deliveries {
+		s.deliveries[d.ID] = d
+	}
+	for _, id := range entry.RemovedSubscriptions {
+		s.InMemoryStore.RemoveSubscription(context.Background(), id)
+	}
+}
+
+// rewrite writes the whole store next to the file and renames it over
+// the file, a crash leaves either the old or the new content.
+func (s *FileStore) rewrite() error {
+	s.InMemoryStore.lock.RLock()
+	content := fileEntry{
+		Subscriptions: make([]Subscription, 0, len(s.subscriptions)),
+		Deliveries:    make([]Delivery, 0, len(s.deliveries)),
+	}
+	for _, sub := range s.subscriptions {
+		content.Subscriptions = append(content.Subscriptions, sub)
+	}
+	for _, d := range s.deliveries {
+		content.Deliveries = append(content.Deliveries, d)
+	}
+	s.InMemoryStore.lock.RUnlock()
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.entries = 0
+	return nil
+}
+
+// append adds an entry to the journal, or rewrites the file when the
+// journal got too long.
+func (s *FileStore) append(entry fileEntry) error {
+	s.InMemoryStore.lock.RLock()
+	records := len(s.subscriptions) + len(s.deliveries)
+	s.InMemoryStore.lock.RUnlock()
+	if s.entries >= records+compactAfter {
+		return s.rewrite()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	s.entries++
+	return f.Close()
+}
+
+// change runs a change of the in-memory store and journals the entry it
+// returns.
+func (s *FileStore) change(f func() (fileEntry, error)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry, err := f()
+	if err != nil {
+		return err
+	}
+	return s.append(entry)
+}
+
+// changeAll runs a change of the in-memory store and rewrites the file.
+func (s *FileStore) changeAll(f func() error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := f(); err != nil {
+		return err
+	}
+	return s.rewrite()
+}
+
+func (s *FileStore) AddSubscription(ctx context.Context, sub Subscription) error {
+	return s.change(func() (fileEntry, error) {
+		return fileEntry{Subscriptions: []Subscription{sub}}, s.InMemoryStore.AddSubscription(ctx, sub)
+	})
+}
+
+func (s *FileStore) RemoveSubscription(ctx context.Context, id string) error {
+	return s.change(func() (fileEntry, error) {
+		return fileEntry{RemovedSubscriptions: []string{id}}, s.InMemoryStore.RemoveSubscription(ctx, id)
+	})
+}
+
+func (s *FileStore) AddDelivery(ctx context.Context, d Delivery) error {
+	return s.change(func() (fileEntry, error) {
+		return fileEntry{Deliveries: []Delivery{d}}, s.InMemoryStore.AddDelivery(ctx, d)
+	})
+}
+
+func (s *FileStore) UpdateDelivery(ctx context.Context, d Delivery) error {
+	return s.change(func() (fileEntry, error) {
+		if err := s.InMemoryStore.UpdateDelivery(ctx, d); err != nil {
+			return fileEntry{}, err
+		}
+		// the event is the stored one
+		stored, err := s.InMemoryStore.Delivery(ctx, d.ID)
+		return fileEntry{Deliveries: []Delivery{stored}}, err
+	})
+}
+
+func (s *FileStore) Anonymize(ctx context.Context, email, alias string) error {
+	return s.changeAll(func() error { return s.InMemoryStore.Anonymize(ctx, email, alias) })
+}
+
+func (s *FileStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	var n int
+	err := s.changeAll(func() (err error) {
+		n, err = s.InMemoryStore.Prune(ctx, before)
+		return err
+	})
+	return n, err
+}
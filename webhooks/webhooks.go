@@ -0,0 +1,557 @@
+// Package webhooks sends the events of the bus to URLs that admins
+// subscribe to event types. Deliveries wait in a Store until they
+// succeed, failed ones are retried with exponential backoff and every
+// attempt is logged.
+//
+// Requests are POSTs of the JSON event with the headers
+//
+//	X-Cake-Event: user.banned
+//	X-Cake-Delivery: <delivery id>
+//	X-Cake-Signature: t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+//
+// keyed with the secret of the subscription. Receivers check it with Verify.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang-api/domain"
+	"golang-api/events"
+)
+
+const (
+	EventHeader     = "X-Cake-Event"
+	DeliveryHeader  = "X-Cake-Delivery"
+	SignatureHeader = "X-Cake-Signature"
+	secretPrefix    = "whsec_"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrPrivateAddress   = errors.New("webhook address is not public")
+)
+
+// sharedAddressSpace is 100.64.0.0/10, the addresses of carrier-grade NAT.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP tells if webhooks may be sent to the address. Loopback, private,
+// link-local (like the 169.254.169.254 metadata service) and multicast
+// addresses belong to the network of the server.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// publicClient only connects to public addresses. The check is made on
+// the address being dialled, so host names resolving to internal
+// addresses and redirects to them are refused as well.
+func publicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
+
+// RetryPolicy is when failed deliveries are tried again. The first retry
+// waits Backoff, every next one twice as long up to MaxBackoff. After
+// MaxAttempts the delivery fails for good, it can still be redelivered
+// by hand.
+type RetryPolicy struct {
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Backoff: 30 * time.Second, MaxBackoff: 6 * time.Hour, MaxAttempts: 10}
+}
+
+// delay is the wait after the failed attempt number n, counted from 1.
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// DefaultRetention is how long finished deliveries stay in the log.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// pruneInterval is how often the worker removes old deliveries.
+const pruneInterval = time.Hour
+
+// RetentionFromEnv reads how many days finished deliveries stay in the
+// log from CAKE_WEBHOOK_RETENTION_DAYS.
+func RetentionFromEnv() (time.Duration, error) {
+	value := os.Getenv("CAKE_WEBHOOK_RETENTION_DAYS")
+	if value == "" {
+		return DefaultRetention, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, errors.New("webhook retention should be a number of days")
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+type Dispatcher struct {
+	store     Store
+	client    *http.Client
+	policy    RetryPolicy
+	retention time.Duration
+	now       func() time.Time
+	// publicOnly refuses URLs of internal hosts, it is set when the
+	// dispatcher made its own client
+	publicOnly bool
+	// sending has a lock for every delivery being sent, it keeps the
+	// worker and Redeliver from sending the same delivery at once
+	locks   sync.Mutex
+	sending map[string]*deliveryLock
+	wake    chan struct{}
+}
+
+type deliveryLock struct {
+	sync.Mutex
+	waiting int
+}
+
+// NewDispatcher returns a dispatcher over the store. A nil client is an
+// http.Client with a 10 second timeout that only connects to public
+// addresses, so admins can't probe the network of the server and read
+// the answers in the delivery log. A client that is passed in may reach
+// any address.
+func NewDispatcher(store Store, client *http.Client, policy RetryPolicy) *Dispatcher {
+	publicOnly := client == nil
+	if client == nil {
+		client = publicClient(10 * time.Second)
+	}
+	return &Dispatcher{
+		store:      store,
+		client:     client,
+		policy:     policy,
+		retention:  DefaultRetention,
+		now:        time.Now,
+		publicOnly: publicOnly,
+		sending:    make(map[string]*deliveryLock),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+func (d *Dispatcher) Store() Store {
+	return d.store
+}
+
+// SetRetention changes how long finished deliveries stay in the log.
+func (d *Dispatcher) SetRetention(retention time.Duration) {
+	d.retention = retention
+}
+
+// Prune removes the finished deliveries older than the retention from
+// the log, Run does it every hour.
+func (d *Dispatcher) Prune(ctx context.Context) (int, error) {
+	return d.store.Prune(ctx, d.now().Add(-d.retention))
+}
+
+// Anonymize replaces the email of a purged user in the delivery log.
+func (d *Dispatcher) Anonymize(ctx context.Context, email, alias string) error {
+	return d.store.Anonymize(ctx, email, alias)
+}
+
+func newID(prefix string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// Subscribe adds a subscription of the URL to the event types. An empty
+// secret gets a random one, the caller shows it to the admin once.
+func (d *Dispatcher) Subscribe(ctx context.Context, rawURL, secret string, types []string) (Subscription, error) {
+	var errs domain.FieldErrors
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, domain.NewFieldError("url", "url", ""))
+	} else if d.publicOnly && internalHost(u.Hostname()) {
+		errs = append(errs, domain.NewFieldError("url", "public_url", ""))
+	}
+	if len(types) == 0 {
+		errs = append(errs, domain.NewFieldError("events", "required", ""))
+	}
+	for _, t := range types {
+		if !contains(events.Types, t) {
+			errs = append(errs, domain.NewFieldError("events", "oneof", strings.Join(events.Types, " ")))
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return Subscription{}, errs
+	}
+	id, err := newID("wh_")
+	if err != nil {
+		return Subscription{}, err
+	}
+	if secret == "" {
+		if secret, err = newID(secretPrefix); err != nil {
+			return Subscription{}, err
+		}
+	}
+	sub := Subscription{ID: id, URL: rawURL, Secret: secret, Events: types, Created: d.now()}
+	return sub, d.store.AddSubscription(ctx, sub)
+}
+
+// internalHost catches the obvious internal hosts when subscribing, names
+// that resolve to internal addresses are refused when they are dialled.
+func internalHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return !publicIP(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Enqueue adds a delivery of the event for every subscription that
+// wants it and wakes the worker of Run.
+func (d *Dispatcher) Enqueue(ctx context.Context, e events.Event) error {
+	subs, err := d.store.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	now := d.now()
+	queued := false
+	for _, sub := range subs {
+		if !sub.Wants(e.Type) {
+			continue
+		}
+		id, err := newID("dlv_")
+		if err != nil {
+			return err
+		}
+		delivery := Delivery{
+			ID:             id,
+			SubscriptionID: sub.ID,
+			Event:          e,
+			Status:         StatusPending,
+			Attempts:       []Attempt{},
+			NextAttempt:    now,
+			Created:        now,
+		}
+		if err := d.store.AddDelivery(ctx, delivery); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// DeliverDue attempts every delivery that is due. It returns the first
+// error of the store, failed requests are recorded in the deliveries.
+// Subscriptions are served in parallel, so a slow receiver only holds up
+// its own deliveries, which go in order.
+func (d *Dispatcher) DeliverDue(ctx context.Context) error {
+	due, err := d.store.Due(ctx, d.now())
+	if err != nil {
+		return err
+	}
+	bySubscription := make(map[string][]Delivery)
+	for _, delivery := range due {
+		bySubscription[delivery.SubscriptionID] = append(bySubscription[delivery.SubscriptionID], delivery)
+	}
+	errs := make(chan error, len(bySubscription))
+	for _, deliveries := range bySubscription {
+		go func(deliveries []Delivery) {
+			errs <- d.deliverAll(ctx, deliveries)
+		}(deliveries)
+	}
+	var first error
+	for range bySubscription {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (d *Dispatcher) deliverAll(ctx context.Context, deliveries []Delivery) error {
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := d.deliver(ctx, delivery.ID, false); err != nil && err != ErrSubscriptionNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redeliver sends a delivery once more right away, whatever its status.
+// It does not change the retry schedule of pending deliveries.
+func (d *Dispatcher) Redeliver(ctx context.Context, id string) (Delivery, error) {
+	return d.deliver(ctx, id, true)
+}
+
+// lockDelivery holds the lock of one delivery until the returned func is
+// called, other deliveries are not held up.
+func (d *Dispatcher) lockDelivery(id string) func() {
+	d.locks.Lock()
+	l, ok := d.sending[id]
+	if !ok {
+		l = &deliveryLock{}
+		d.sending[id] = l
+	}
+	l.waiting++
+	d.locks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		d.locks.Lock()
+		if l.waiting--; l.waiting == 0 {
+			delete(d.sending, id)
+		}
+		d.locks.Unlock()
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, id string, manual bool) (Delivery, error) {
+	unlock := d.lockDelivery(id)
+	defer unlock()
+
+	// reloaded under the lock, Redeliver may have sent it meanwhile
+	delivery, err := d.store.Delivery(ctx, id)
+	if err != nil {
+		return delivery, err
+	}
+	if !manual && (delivery.Status != StatusPending || delivery.NextAttempt.After(d.now())) {
+		return delivery, nil
+	}
+	sub, err := d.store.Subscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return delivery, err
+	}
+
+	attempt := d.send(ctx, sub, delivery)
+	attempt.Manual = manual
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	switch {
+	case attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		delivery.Status = StatusDelivered
+		delivery.NextAttempt = time.Time{}
+	case manual:
+		// the schedule of automatic retries stays as it was
+	case automaticAttempts(delivery) >= d.policy.MaxAttempts:
+		delivery.Status = StatusFailed
+		delivery.NextAttempt = time.Time{}
+	default:
+		delivery.NextAttempt = attempt.Time.Add(d.policy.delay(automaticAttempts(delivery)))
+	}
+	return delivery, d.store.UpdateDelivery(ctx, delivery)
+}
+
+func automaticAttempts(delivery Delivery) int {
+	n := 0
+	for _, a := range delivery.Attempts {
+		if !a.Manual {
+			n++
+		}
+	}
+	return n
+}
+
+// send makes one request of the delivery. Only 2xx responses count as
+// delivered.
+func (d *Dispatcher) send(ctx context.Context, sub Subscription, delivery Delivery) (attempt Attempt) {
+	attempt.Time = d.now()
+	started := time.Now()
+	defer func() { attempt.Duration = time.Since(started) }()
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event.Type)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, signatureHeader(sub.Secret, attempt.Time.Unix(), body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	// the body is not used, reading a bit of it lets the connection be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	return attempt
+}
+
+// Run queues the events of the bus and delivers them until ctx is done.
+// Due retries are looked for every interval. Run returns once the delivery
+// in progress is done.
+func (d *Dispatcher) Run(ctx context.Context, bus *events.Bus, interval time.Duration) {
+	all := func(events.Event) bool { return true }
+	sub := bus.Subscribe(all)
+	defer func() { bus.Unsubscribe(sub) }()
+
+	worker := make(chan struct{})
+	go func() {
+		defer close(worker)
+		d.work(ctx, interval)
+	}()
+	defer func() { <-worker }()
+
+	var lastID uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// the store was too slow, the missed events are in the buffer
+				var replay []events.Event
+				var complete bool
+				sub, replay, complete = bus.Resume(lastID, all)
+				if !complete {
+					log.Println("Webhooks missed events after", lastID)
+				}
+				for _, e := range replay {
+					d.enqueue(ctx, e)
+					lastID = e.ID
+				}
+				continue
+			}
+			d.enqueue(ctx, e)
+			lastID = e.ID
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, e events.Event) {
+	if err := d.Enqueue(ctx, e); err != nil {
+		log.Printf("Could not queue webhooks of event %d: %v", e.ID, err)
+	}
+}
+
+func (d *Dispatcher) work(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		if err := d.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			log.Println("Could not deliver webhooks:", err)
+		}
+		if time.Since(pruned) >= pruneInterval {
+			pruned = time.Now()
+			if _, err := d.Prune(ctx); err != nil && ctx.Err() == nil {
+				log.Println("Could not prune the webhook log:", err)
+			}
+		}
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" with the secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func signatureHeader(secret string, timestamp int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(secret, timestamp, body))
+}
+
+// Verify checks the X-Cake-Signature header of a request with the body.
+// Signatures older than tolerance are rejected against replays.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value := part, ""
+		if eq := strings.Index(part, "="); eq >= 0 {
+			key, value = part[:eq], part[eq+1:]
+		}
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang-api/events"
+)
+
+// receiver is an endpoint that checks signatures at the time of the
+// dispatcher and fails the first failures requests.
+type receiver struct {
+	t        *testing.T
+	secret   string
+	now      *time.Time
+	lock     sync.Mutex
+	failures int
+	received []events.Event
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := Verify(rc.secret, r.Header.Get(SignatureHeader), body, *rc.now, time.Minute); err != nil {
+		rc.t.Error(err)
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	e := events.Event{}
+	json.Unmarshal(body, &e)
+	if r.Header.Get(EventHeader) != e.Type {
+		rc.t.Error("unexpected event header", r.Header.Get(EventHeader))
+	}
+	rc.received = append(rc.received, e)
+}
+
+func (rc *receiver) events() []events.Event {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	return append([]events.Event(nil), rc.received...)
+}
+
+func newTestDispatcher(t *testing.T, failures int) (*Dispatcher, *receiver, Subscription, *time.Time) {
+	now := time.Now()
+	rc := &receiver{t: t, secret: "topsecret", now: &now, failures: failures}
+	ts := httptest.NewServer(rc)
+	t.Cleanup(ts.Close)
+
+	// the receiver listens on loopback, which the default client refuses
+	d := NewDispatcher(NewInMemoryStore(), &http.Client{Timeout: 5 * time.Second}, RetryPolicy{Backoff: time.Minute, MaxBackoff: 3 * time.Minute, MaxAttempts: 4})
+	d.now = func() time.Time { return now }
+	sub, err := d.Subscribe(context.Background(), ts.URL, rc.secret, []string{events.UserRegistered, events.UserBanned})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, rc, sub, &now
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("subscribe", func(t *testing.T) {
+		d := NewDispatcher(NewInMemoryStore(), nil, DefaultRetryPolicy())
+		if _, err := d.Subscribe(ctx, "ftp://crm.example.com", "", []string{events.UserBanned}); err == nil {
+			t.Error("subscribed a non-http URL")
+		}
+		if _, err := d.Subscribe(ctx, "https://crm.example.com/hook", "", []string{"user.eaten"}); err == nil {
+			t.Error("subscribed to an unknown event")
+		}
+		sub, err := d.Subscribe(ctx, "https://crm.example.com/hook", "", []string{events.UserBanned})
+		if err != nil || len(sub.Secret) != len(secretPrefix)+32 {
+			t.Error(sub, err)
+		}
+	})
+
+	t.Run("subscribe refuses internal addresses", func(t *testing.T) {
+		d := NewDispatcher(NewInMemoryStore(), nil, DefaultRetryPolicy())
+		for _, u := range []string{
+			"http://127.0.0.1:8080/hook",
+			"http://169.254.169.254/latest/meta-data",
+			"http://10.0.0.5/hook",
+			"http://[::1]/hook",
+			"http://localhost:6379",
+		} {
+			if _, err := d.Subscribe(ctx, u, "", []string{events.UserBanned}); err == nil {
+				t.Error("subscribed an internal address", u)
+			}
+		}
+	})
+
+	t.Run("internal addresses are refused when dialled", func(t *testing.T) {
+		called := false
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		defer ts.Close()
+
+		d := NewDispatcher(NewInMemoryStore(), nil, DefaultRetryPolicy())
+		// as if a public host name resolved to loopback
+		sub := Subscription{ID: "wh_internal", URL: ts.URL, Secret: "topsecret", Events: []string{events.UserBanned}, Created: time.Now()}
+		if err := d.Store().AddSubscription(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+		d.Enqueue(ctx, events.Event{ID: 1, Type: events.UserBanned, Email: "test@mail.com"})
+		d.DeliverDue(ctx)
+
+		deliveries, _ := d.Store().Deliveries(ctx, sub.ID)
+		if len(deliveries) != 1 || len(deliveries[0].Attempts) != 1 || !strings.Contains(deliveries[0].Attempts[0].Error, ErrPrivateAddress.Error()) {
+			t.Error("unexpected deliveries", deliveries)
+		}
+		if called {
+			t.Error("the internal receiver was called")
+		}
+	})
+
+	t.Run("retries with backoff", func(t *testing.T) {
+		d, rc, sub, now := newTestDispatcher(t, 2)
+		d.Enqueue(ctx, events.Event{ID: 1, Type: events.UserRegistered, Email: "test@mail.com"})
+		d.Enqueue(ctx, events.Event{ID: 2, Type: events.ProfileUpdated, Email: "test@mail.com"})
+
+		d.DeliverDue(ctx)
+		deliveries, _ := d.Store().Deliveries(ctx, sub.ID)
+		if len(deliveries) != 1 || deliveries[0].Status != StatusPending || len(deliveries[0].Attempts) != 1 {
+			t.Fatal("unexpected deliveries", deliveries)
+		}
+		if deliveries[0].Attempts[0].StatusCode != 503 || !deliveries[0].NextAttempt.Equal(now.Add(time.Minute)) {
+			t.Error("unexpected first attempt", deliveries[0])
+		}
+
+		// not due yet
+		*now = now.Add(59 * time.Second)
+		d.DeliverDue(ctx)
+		*now = now.Add(time.Second)
+		d.DeliverDue(ctx)
+		delivery, _ := d.Store().Delivery(ctx, deliveries[0].ID)
+		if len(delivery.Attempts) != 2 || !delivery.NextAttempt.Equal(now.Add(2*time.Minute)) {
+			t.Error("unexpected second attempt", delivery)
+		}
+
+		*now = now.Add(2 * time.Minute)
+		d.DeliverDue(ctx)
+		delivery, _ = d.Store().Delivery(ctx, delivery.ID)
+		if delivery.Status != StatusDelivered || len(delivery.Attempts) != 3 || len(rc.events()) != 1 {
+			t.Error("not delivered", delivery)
+		}
+	})
+
+	t.Run("fails after max attempts and redelivers", func(t *testing.T) {
+		d, rc, sub, now := newTestDispatcher(t, 5)
+		d.Enqueue(ctx, events.Event{ID: 1, Type: events.UserBanned, Email: "test@mail.com", Actor: "admin@mail.com"})
+		for i := 0; i < 5; i++ {
+			d.DeliverDue(ctx)
+			*now = now.Add(3 * time.Minute)
+		}
+		deliveries, _ := d.Store().Deliveries(ctx, sub.ID)
+		if deliveries[0].Status != StatusFailed || len(deliveries[0].Attempts) != 4 {
+			t.Fatal("unexpected delivery", deliveries[0])
+		}
+
+		delivery, err := d.Redeliver(ctx, deliveries[0].ID)
+		if err != nil || delivery.Status != StatusFailed || !delivery.Attempts[4].Manual {
+			t.Error("unexpected failed redelivery", delivery, err)
+		}
+		delivery, err = d.Redeliver(ctx, deliveries[0].ID)
+		if err != nil || delivery.Status != StatusDelivered || len(rc.events()) != 1 || rc.events()[0].Actor != "admin@mail.com" {
+			t.Error("unexpected redelivery", delivery, err)
+		}
+		if _, err := d.Redeliver(ctx, "dlv_missing"); err != ErrDeliveryNotFound {
+			t.Error("unexpected error", err)
+		}
+	})
+
+	t.Run("a slow receiver holds up only its own deliveries", func(t *testing.T) {
+		d, rc, _, _ := newTestDispatcher(t, 0)
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer slow.Close()
+		defer close(release)
+		if _, err := d.Subscribe(ctx, slow.URL, "", []string{events.UserRegistered}); err != nil {
+			t.Fatal(err)
+		}
+		d.Enqueue(ctx, events.Event{ID: 1, Type: events.UserRegistered, Email: "test@mail.com"})
+
+		done := make(chan error, 1)
+		go func() { done <- d.DeliverDue(ctx) }()
+		for deadline := time.Now().Add(5 * time.Second); len(rc.events()) == 0; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("delivery waited for the slow receiver")
+			}
+		}
+		select {
+		case <-done:
+			t.Error("slow receiver was not waited for")
+		default:
+		}
+	})
+	t.Run("runs from the bus", func(t *testing.T) {
+		d, rc, _, _ := newTestDispatcher(t, 0)
+		bus := events.NewBus(events.DefaultBufferSize)
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		done := make(chan struct{})
+		go func() {
+			d.Run(runCtx, bus, time.Hour)
+			close(done)
+		}()
+		// Run subscribes in its goroutine, publish until it listens
+		deadline := time.Now().Add(5 * time.Second)
+		for len(rc.events()) == 0 && time.Now().Before(deadline) {
+			bus.Publish(events.Event{Type: events.UserRegistered, Email: "test@mail.com"})
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(rc.events()) == 0 {
+			t.Fatal("nothing was delivered")
+		}
+		cancel()
+		<-done
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.AddSubscription(ctx, Subscription{ID: "wh_1", URL: "https://crm.example.com", Secret: "s", Events: []string{events.UserBanned}})
+	store.AddDelivery(ctx, Delivery{ID: "dlv_1", SubscriptionID: "wh_1", Status: StatusPending, NextAttempt: time.Now()})
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, _ := reloaded.Due(ctx, time.Now())
+	if sub, err := reloaded.Subscription(ctx, "wh_1"); err != nil || sub.Secret != "s" || len(due) != 1 {
+		t.Error("store was not reloaded", sub, due, err)
+	}
+
+	// pending deliveries go with the subscription
+	reloaded.RemoveSubscription(ctx, "wh_1")
+	reloaded, _ = NewFileStore(path)
+	if due, _ := reloaded.Due(ctx, time.Now()); len(due) != 0 {
+		t.Error("pending delivery was kept", due)
+	}
+}
+
+func TestFileStoreJournal(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	store, _ := NewFileStore(path)
+	store.AddSubscription(ctx, Subscription{ID: "wh_1", URL: "https://crm.example.com", Events: []string{events.UserBanned}})
+	old := time.Now().Add(-48 * time.Hour)
+	for _, d := range []Delivery{
+		{ID: "dlv_old", Status: StatusDelivered, Created: old, Attempts: []Attempt{{Time: old, StatusCode: 200}}},
+		{ID: "dlv_dead", Status: StatusFailed, Created: old, Attempts: []Attempt{{Time: old, StatusCode: 500}}},
+		{ID: "dlv_pending", Status: StatusPending, Created: old, NextAttempt: time.Now()},
+		{ID: "dlv_recent", Status: StatusDelivered, Created: time.Now(), Attempts: []Attempt{{Time: time.Now(), StatusCode: 200}}},
+	} {
+		d.SubscriptionID = "wh_1"
+		d.Event = events.Event{ID: 1, Type: events.UserBanned, Email: "test@mail.com"}
+		store.AddDelivery(ctx, d)
+	}
+
+	lines := func() []string {
+		data, _ := ioutil.ReadFile(path)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	before := lines()
+	pending, _ := store.Delivery(ctx, "dlv_pending")
+	pending.Attempts = append(pending.Attempts, Attempt{Time: time.Now(), StatusCode: 503})
+	pending.Event.Email = "changed@mail.com"
+	store.UpdateDelivery(ctx, pending)
+	after := lines()
+	if len(after) != len(before)+1 || after[0] != before[0] {
+		t.Fatal("the update was not appended", len(before), len(after))
+	}
+
+	// a crash in the middle of an entry loses only that entry
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"deliveries":[{"id":"dlv_torn"`)
+	f.Close()
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery, err := reloaded.Delivery(ctx, "dlv_pending")
+	if err != nil || len(delivery.Attempts) != 1 || delivery.Event.Email != "test@mail.com" {
+		t.Error("update was not reloaded", delivery, err)
+	}
+	if len(lines()) != 1 {
+		t.Error("the file was not rewritten on load", len(lines()))
+	}
+
+	n, err := reloaded.Prune(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil || n != 2 {
+		t.Fatal("unexpected prune", n, err)
+	}
+	reloaded, _ = NewFileStore(path)
+	deliveries, _ := reloaded.Deliveries(ctx, "wh_1")
+	if len(deliveries) != 2 || deliveries[0].ID != "dlv_recent" || deliveries[1].ID != "dlv_pending" {
+		t.Error("unexpected deliveries after the prune", deliveries)
+	}
+}